@@ -84,6 +84,7 @@ func (a *App) Start() error {
 			&models.Group{},
 			&models.APIKey{},
 			&models.RequestLog{},
+			&models.RequestPayload{},
 			&models.GroupHourlyStat{},
 		); err != nil {
 			return fmt.Errorf("database auto-migration failed: %w", err)
@@ -73,6 +73,21 @@ func (ch *AnthropicChannel) ExtractModel(c *gin.Context, bodyBytes []byte) strin
 	return ""
 }
 
+// ExtractUsage parses the usage block of a message or of a message_start/message_delta event.
+func (ch *AnthropicChannel) ExtractUsage(data []byte) *models.TokenUsage {
+	return parseAnthropicUsage(data)
+}
+
+// ParseStreamError recognizes the error event of the Messages API, e.g. overloaded_error.
+func (ch *AnthropicChannel) ParseStreamError(event string, data []byte) (int, bool) {
+	return parseAnthropicStreamError(event, data)
+}
+
+// WriteError writes a proxy-generated error in the Anthropic {"type": "error", "error": {...}} envelope.
+func (ch *AnthropicChannel) WriteError(c *gin.Context, apiErr *app_errors.APIError) {
+	WriteError(c, "anthropic", apiErr)
+}
+
 // ValidateKey checks if the given API key is valid by making a messages request.
 func (ch *AnthropicChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
 	upstreamURL := ch.getUpstreamURL()
@@ -2,6 +2,7 @@ package channel
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"gpt-load/internal/models"
 	"gpt-load/internal/types"
@@ -10,6 +11,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"gorm.io/datatypes"
 )
@@ -18,7 +20,11 @@ import (
 type UpstreamInfo struct {
 	URL           *url.URL
 	Weight        int
+	Priority      int
 	CurrentWeight int
+	health        upstreamHealth
+	inFlight      int
+	latency       time.Duration // moving average of the time to response headers
 }
 
 // BaseChannel provides common functionality for channel proxies.
@@ -30,6 +36,8 @@ type BaseChannel struct {
 	TestModel          string
 	ValidationEndpoint string
 	upstreamLock       sync.Mutex
+	healthCheckStop    chan struct{}
+	healthCheckOnce    sync.Once
 
 	// Cached fields from the group for stale check
 	channelType     string
@@ -37,47 +45,67 @@ type BaseChannel struct {
 	effectiveConfig *types.SystemSettings
 }
 
-// getUpstreamURL selects an upstream URL using a smooth weighted round-robin algorithm.
+// getUpstreamURL selects an upstream URL using the group's upstream strategy.
 func (b *BaseChannel) getUpstreamURL() *url.URL {
 	b.upstreamLock.Lock()
 	defer b.upstreamLock.Unlock()
 
+	if up := b.selectUpstream(); up != nil {
+		return up.URL
+	}
+	return nil
+}
+
+// selectUpstream picks an upstream with the configured strategy, defaulting to smooth weighted round-robin.
+// Upstreams with an open circuit are skipped unless none is available.
+// Must be called with upstreamLock held.
+func (b *BaseChannel) selectUpstream() *UpstreamInfo {
 	if len(b.Upstreams) == 0 {
 		return nil
 	}
 	if len(b.Upstreams) == 1 {
-		return b.Upstreams[0].URL
+		return &b.Upstreams[0]
 	}
 
-	totalWeight := 0
-	var best *UpstreamInfo
-
+	now := time.Now()
+	candidates := make([]*UpstreamInfo, 0, len(b.Upstreams))
 	for i := range b.Upstreams {
-		up := &b.Upstreams[i]
-		totalWeight += up.Weight
-		up.CurrentWeight += up.Weight
-
-		if best == nil || up.CurrentWeight > best.CurrentWeight {
-			best = up
+		if b.isAvailable(&b.Upstreams[i], now) {
+			candidates = append(candidates, &b.Upstreams[i])
+		}
+	}
+	if len(candidates) == 0 {
+		for i := range b.Upstreams {
+			candidates = append(candidates, &b.Upstreams[i])
 		}
 	}
 
+	best := b.pickUpstream(candidates)
 	if best == nil {
-		return b.Upstreams[0].URL // 降级到第一个可用的
+		return &b.Upstreams[0] // 降级到第一个可用的
 	}
 
-	best.CurrentWeight -= totalWeight
-	return best.URL
+	if best.health.state == circuitHalfOpen {
+		best.health.probeStartedAt = now
+	}
+	return best
 }
 
 // BuildUpstreamURL constructs the target URL for the upstream service.
+// The selected upstream counts the request as in flight until ReleaseUpstream is called.
 func (b *BaseChannel) BuildUpstreamURL(originalURL *url.URL, group *models.Group) (string, error) {
-	base := b.getUpstreamURL()
-	if base == nil {
+	b.upstreamLock.Lock()
+	up := b.selectUpstream()
+	if up != nil {
+		up.inFlight++
+	}
+	b.upstreamLock.Unlock()
+
+	if up == nil {
 		return "", fmt.Errorf("no upstream URL configured for channel %s", b.Name)
 	}
 
-	finalURL := *base
+	finalURL := *up.URL
 	proxyPrefix := "/proxy/" + group.Name
 	requestPath := originalURL.Path
 	requestPath = strings.TrimPrefix(requestPath, proxyPrefix)
@@ -89,6 +117,28 @@ func (b *BaseChannel) BuildUpstreamURL(originalURL *url.URL, group *models.Group
 	return finalURL.String(), nil
 }
 
+// RewriteModel replaces the "model" field of a JSON request body. The URL is left unchanged.
+func (b *BaseChannel) RewriteModel(requestURL *url.URL, bodyBytes []byte, model string) (*url.URL, []byte, error) {
+	if len(bodyBytes) == 0 {
+		return requestURL, bodyBytes, nil
+	}
+
+	var requestData map[string]any
+	if err := json.Unmarshal(bodyBytes, &requestData); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+	if _, ok := requestData["model"]; !ok {
+		return requestURL, bodyBytes, nil
+	}
+	requestData["model"] = model
+
+	rewritten, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return requestURL, rewritten, nil
+}
+
 // IsConfigStale checks if the channel's configuration is stale compared to the provided group.
 func (b *BaseChannel) IsConfigStale(group *models.Group) bool {
 	if b.channelType != group.ChannelType {
@@ -2,9 +2,11 @@ package channel
 
 import (
 	"context"
+	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,6 +16,23 @@ type ChannelProxy interface {
 	// BuildUpstreamURL constructs the target URL for the upstream service.
 	BuildUpstreamURL(originalURL *url.URL, group *models.Group) (string, error)
 
+	// MarkUpstreamSuccess records that the upstream of the given URL answered a request after the given latency.
+	MarkUpstreamSuccess(upstreamURL string, latency time.Duration)
+
+	// MarkUpstreamFailure records a connection error or 5xx response of the upstream of the given URL.
+	// It returns true when the failure is attributed to the upstream rather than the API key,
+	// which requires another available upstream.
+	MarkUpstreamFailure(upstreamURL string) bool
+
+	// ReleaseUpstream marks a request built by BuildUpstreamURL as finished.
+	ReleaseUpstream(upstreamURL string)
+
+	// UpstreamStatus returns the upstream selection strategy and the observed state of each upstream.
+	UpstreamStatus() UpstreamStatus
+
+	// StopHealthCheck stops background health checks when the channel is replaced.
+	StopHealthCheck()
+
 	// IsConfigStale checks if the channel's configuration is stale compared to the provided group.
 	IsConfigStale(group *models.Group) bool
 
@@ -32,6 +51,19 @@ type ChannelProxy interface {
 	// ExtractModel extracts the model name from the request.
 	ExtractModel(c *gin.Context, bodyBytes []byte) string
 
+	// RewriteModel replaces the requested model with the given upstream model, in the path or in the body.
+	RewriteModel(requestURL *url.URL, bodyBytes []byte, model string) (*url.URL, []byte, error)
+
+	// ExtractUsage extracts token usage from a response body or a single stream event payload.
+	ExtractUsage(data []byte) *models.TokenUsage
+
+	// ParseStreamError reports whether a stream event payload is an error the upstream sent after answering 200,
+	// together with the HTTP status that matches it.
+	ParseStreamError(event string, data []byte) (statusCode int, isError bool)
+
+	// WriteError writes an error generated by the proxy, e.g. when no key is left, in the channel's native error format.
+	WriteError(c *gin.Context, apiErr *app_errors.APIError)
+
 	// ValidateKey checks if the given API key is valid.
 	ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error)
 }
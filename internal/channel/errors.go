@@ -0,0 +1,170 @@
+package channel
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nativeErrorFormats builds the error envelope of each API format for an error generated by the proxy itself,
+// returning the status code to send with it.
+var nativeErrorFormats = map[string]func(apiErr *app_errors.APIError) (int, []byte){
+	"openai":    formatOpenAIError,
+	"anthropic": formatAnthropicError,
+	"gemini":    formatGeminiError,
+}
+
+// FormatError builds an error generated by the proxy in the native error format of an API.
+// Unknown formats get the proxy's own {"code", "message"} shape.
+func FormatError(format string, apiErr *app_errors.APIError) (int, []byte) {
+	formatError, ok := nativeErrorFormats[format]
+	if !ok {
+		body, _ := json.Marshal(map[string]string{"code": apiErr.Code, "message": apiErr.Message})
+		return apiErr.HTTPStatus, body
+	}
+	return formatError(apiErr)
+}
+
+// WriteError writes an error generated by the proxy in the native error format of an API,
+// so that the API's SDKs can parse it and apply their retry logic.
+func WriteError(c *gin.Context, format string, apiErr *app_errors.APIError) {
+	if format == "gemini" && strings.Contains(c.Request.URL.Path, "v1beta/openai") {
+		format = "openai"
+	}
+	statusCode, body := FormatError(format, apiErr)
+	if format == "openai" || format == "anthropic" {
+		// The OpenAI and Anthropic SDKs follow this header before their status-based retry rules.
+		c.Header("X-Should-Retry", strconv.FormatBool(isRetryableStatus(statusCode)))
+	}
+	c.Data(statusCode, "application/json", body)
+}
+
+// RequestFormat guesses the API format of a request from its path and auth headers alone,
+// for errors written before the request is matched to a group.
+func RequestFormat(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case strings.Contains(path, "v1beta/openai"):
+		return "openai"
+	case r.Header.Get("anthropic-version") != "" || strings.HasSuffix(path, "/v1/messages"):
+		return "anthropic"
+	case r.Header.Get("x-goog-api-key") != "" || r.URL.Query().Has("key") || strings.Contains(path, "/v1beta/"),
+		strings.Contains(path, "/models/") && strings.Contains(path, ":"):
+		return "gemini"
+	default:
+		return "openai"
+	}
+}
+
+// isRetryableStatus matches the statuses the official SDKs retry by default.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout || statusCode == http.StatusConflict ||
+		statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// formatOpenAIError returns {"error": {"message", "type", "param", "code"}}.
+func formatOpenAIError(apiErr *app_errors.APIError) (int, []byte) {
+	errType := "invalid_request_error"
+	code := strings.ToLower(apiErr.Code)
+	switch {
+	case apiErr.HTTPStatus == http.StatusUnauthorized:
+		code = "invalid_api_key"
+	case apiErr.HTTPStatus == http.StatusForbidden:
+		errType = "permission_error"
+	case apiErr.HTTPStatus == http.StatusTooManyRequests:
+		errType = "rate_limit_error"
+	case apiErr.HTTPStatus >= http.StatusInternalServerError:
+		errType = "server_error"
+	}
+	body, _ := json.Marshal(map[string]any{"error": map[string]any{
+		"message": apiErr.Message,
+		"type":    errType,
+		"param":   nil,
+		"code":    code,
+	}})
+	return apiErr.HTTPStatus, body
+}
+
+// formatAnthropicError returns {"type": "error", "error": {"type", "message"}}.
+// Running out of keys is reported as a 529 overloaded_error, which the Anthropic SDK retries with backoff.
+func formatAnthropicError(apiErr *app_errors.APIError) (int, []byte) {
+	statusCode := apiErr.HTTPStatus
+	if statusCode == http.StatusServiceUnavailable {
+		statusCode = 529
+	}
+	body, _ := json.Marshal(map[string]any{
+		"type":  "error",
+		"error": map[string]string{"type": ErrorTypeForStatus(statusCode), "message": apiErr.Message},
+	})
+	return statusCode, body
+}
+
+// formatGeminiError returns Google's {"error": {"code", "message", "status"}}.
+// Like the Gemini API, an invalid key is a 400 INVALID_ARGUMENT with the API_KEY_INVALID reason.
+func formatGeminiError(apiErr *app_errors.APIError) (int, []byte) {
+	statusCode := apiErr.HTTPStatus
+	errBody := map[string]any{"message": apiErr.Message}
+	if statusCode == http.StatusUnauthorized {
+		statusCode = http.StatusBadRequest
+		errBody["details"] = []map[string]any{{
+			"@type":  "type.googleapis.com/google.rpc.ErrorInfo",
+			"reason": "API_KEY_INVALID",
+			"domain": "googleapis.com",
+		}}
+	}
+	errBody["code"] = statusCode
+	errBody["status"] = GeminiStatusForCode(statusCode)
+	body, _ := json.Marshal(map[string]any{"error": errBody})
+	return statusCode, body
+}
+
+// ErrorTypeForStatus maps an HTTP status code to the error type names shared by OpenAI and Anthropic.
+func ErrorTypeForStatus(statusCode int) string {
+	switch {
+	case statusCode == http.StatusBadRequest:
+		return "invalid_request_error"
+	case statusCode == http.StatusUnauthorized:
+		return "authentication_error"
+	case statusCode == http.StatusForbidden:
+		return "permission_error"
+	case statusCode == http.StatusNotFound:
+		return "not_found_error"
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case statusCode == 529:
+		return "overloaded_error"
+	case statusCode >= 500:
+		return "api_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// GeminiStatusForCode maps an HTTP status code to the canonical status name used by Google APIs.
+func GeminiStatusForCode(statusCode int) string {
+	switch {
+	case statusCode == http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case statusCode == http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case statusCode == http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case statusCode == http.StatusNotFound:
+		return "NOT_FOUND"
+	case statusCode == http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case statusCode == http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case statusCode >= 500:
+		return "INTERNAL"
+	default:
+		return "INVALID_ARGUMENT"
+	}
+}
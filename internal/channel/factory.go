@@ -64,6 +64,7 @@ func (f *Factory) GetChannel(group *models.Group) (ChannelProxy, error) {
 		if !channel.IsConfigStale(group) {
 			return channel, nil
 		}
+		channel.StopHealthCheck()
 	}
 
 	logrus.Debugf("Creating new channel for group %d with type '%s'", group.ID, group.ChannelType)
@@ -83,8 +84,9 @@ func (f *Factory) GetChannel(group *models.Group) (ChannelProxy, error) {
 // newBaseChannel is a helper function to create and configure a BaseChannel.
 func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel, error) {
 	type upstreamDef struct {
-		URL    string `json:"url"`
-		Weight int    `json:"weight"`
+		URL      string `json:"url"`
+		Weight   int    `json:"weight"`
+		Priority int    `json:"priority"`
 	}
 
 	var defs []upstreamDef
@@ -106,7 +108,7 @@ func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel
 		if weight <= 0 {
 			weight = 1
 		}
-		upstreamInfos = append(upstreamInfos, UpstreamInfo{URL: u, Weight: weight})
+		upstreamInfos = append(upstreamInfos, UpstreamInfo{URL: u, Weight: weight, Priority: def.Priority})
 	}
 
 	// Base configuration for regular requests, derived from the group's effective settings.
@@ -140,7 +142,7 @@ func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel
 	httpClient := f.clientManager.GetClient(clientConfig)
 	streamClient := f.clientManager.GetClient(&streamConfig)
 
-	return &BaseChannel{
+	base := &BaseChannel{
 		Name:               name,
 		Upstreams:          upstreamInfos,
 		HTTPClient:         httpClient,
@@ -150,5 +152,8 @@ func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel
 		channelType:        group.ChannelType,
 		groupUpstreams:     group.Upstreams,
 		effectiveConfig:    &group.EffectiveConfig,
-	}, nil
+	}
+	base.startHealthCheck()
+
+	return base, nil
 }
@@ -95,6 +95,49 @@ func (ch *GeminiChannel) ExtractModel(c *gin.Context, bodyBytes []byte) string {
 	return ""
 }
 
+// RewriteModel replaces the model segment of native paths like models/{model}:generateContent,
+// falling back to the request body for the OpenAI-compatible endpoint.
+func (ch *GeminiChannel) RewriteModel(requestURL *url.URL, bodyBytes []byte, model string) (*url.URL, []byte, error) {
+	parts := strings.Split(requestURL.Path, "/")
+	for i, part := range parts {
+		if part == "models" && i+1 < len(parts) {
+			segment := parts[i+1]
+			if idx := strings.Index(segment, ":"); idx >= 0 {
+				parts[i+1] = model + segment[idx:]
+			} else {
+				parts[i+1] = model
+			}
+			rewritten := *requestURL
+			rewritten.Path = strings.Join(parts, "/")
+			rewritten.RawPath = ""
+			return &rewritten, bodyBytes, nil
+		}
+	}
+
+	return ch.BaseChannel.RewriteModel(requestURL, bodyBytes, model)
+}
+
+// ExtractUsage parses usageMetadata, falling back to the OpenAI format used by the compatible endpoint.
+func (ch *GeminiChannel) ExtractUsage(data []byte) *models.TokenUsage {
+	if usage := parseGeminiUsage(data); usage != nil {
+		return usage
+	}
+	return parseOpenAIUsage(data)
+}
+
+// ParseStreamError recognizes Gemini error chunks, falling back to the OpenAI format used by the compatible endpoint.
+func (ch *GeminiChannel) ParseStreamError(event string, data []byte) (int, bool) {
+	if statusCode, ok := parseGeminiStreamError(data); ok {
+		return statusCode, true
+	}
+	return parseOpenAIStreamError(event, data)
+}
+
+// WriteError writes a proxy-generated error in the Google {"error": {"code", "status"}} envelope, or the OpenAI one on the compatible endpoint.
+func (ch *GeminiChannel) WriteError(c *gin.Context, apiErr *app_errors.APIError) {
+	WriteError(c, "gemini", apiErr)
+}
+
 // ValidateKey checks if the given API key is valid by making a generateContent request.
 func (ch *GeminiChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
 	upstreamURL := ch.getUpstreamURL()
@@ -72,6 +72,21 @@ func (ch *OpenAIChannel) ExtractModel(c *gin.Context, bodyBytes []byte) string {
 	return ""
 }
 
+// ExtractUsage parses the usage block of a Chat Completions or Responses API payload.
+func (ch *OpenAIChannel) ExtractUsage(data []byte) *models.TokenUsage {
+	return parseOpenAIUsage(data)
+}
+
+// ParseStreamError recognizes error chunks of the Chat Completions API and error events of the Responses API.
+func (ch *OpenAIChannel) ParseStreamError(event string, data []byte) (int, bool) {
+	return parseOpenAIStreamError(event, data)
+}
+
+// WriteError writes a proxy-generated error in the OpenAI {"error": {...}} envelope.
+func (ch *OpenAIChannel) WriteError(c *gin.Context, apiErr *app_errors.APIError) {
+	WriteError(c, "openai", apiErr)
+}
+
 // ValidateKey checks if the given API key is valid by making a chat completion request.
 func (ch *OpenAIChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
 	upstreamURL := ch.getUpstreamURL()
@@ -0,0 +1,94 @@
+package channel
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// streamErrorDetail matches the error object of the OpenAI, Anthropic and Gemini APIs.
+type streamErrorDetail struct {
+	Type   string          `json:"type"`
+	Code   json.RawMessage `json:"code"`
+	Status string          `json:"status"`
+}
+
+// statusCode guesses the HTTP status the upstream would have returned for the error
+// had it not already answered 200: from a numeric code, or from the error type.
+func (d *streamErrorDetail) statusCode() int {
+	if code, err := strconv.Atoi(strings.Trim(string(d.Code), `"`)); err == nil && code >= 400 && code < 600 {
+		return code
+	}
+	kind := strings.ToLower(d.Type + " " + d.Status + " " + strings.Trim(string(d.Code), `"`))
+	switch {
+	case strings.Contains(kind, "overloaded"):
+		return 529
+	case strings.Contains(kind, "rate_limit"), strings.Contains(kind, "quota"), strings.Contains(kind, "resource_exhausted"):
+		return http.StatusTooManyRequests
+	case strings.Contains(kind, "authentication"), strings.Contains(kind, "invalid_api_key"), strings.Contains(kind, "unauthenticated"):
+		return http.StatusUnauthorized
+	case strings.Contains(kind, "permission"):
+		return http.StatusForbidden
+	case strings.Contains(kind, "invalid_request"), strings.Contains(kind, "invalid_argument"):
+		return http.StatusBadRequest
+	case strings.Contains(kind, "unavailable"):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// parseOpenAIStreamError recognizes a Chat Completions chunk carrying {"error": {...}},
+// and the "error" and "response.failed" events of the Responses API.
+func parseOpenAIStreamError(event string, data []byte) (int, bool) {
+	var payload struct {
+		Type     string             `json:"type"`
+		Code     json.RawMessage    `json:"code"`
+		Error    *streamErrorDetail `json:"error"`
+		Response *struct {
+			Error *streamErrorDetail `json:"error"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return 0, false
+	}
+	switch {
+	case payload.Error != nil:
+		return payload.Error.statusCode(), true
+	case payload.Type == "response.failed" && payload.Response != nil && payload.Response.Error != nil:
+		return payload.Response.Error.statusCode(), true
+	case payload.Type == "error" || event == "error":
+		detail := streamErrorDetail{Code: payload.Code}
+		return detail.statusCode(), true
+	}
+	return 0, false
+}
+
+// parseAnthropicStreamError recognizes the "error" event of the Messages API.
+func parseAnthropicStreamError(event string, data []byte) (int, bool) {
+	var payload struct {
+		Type  string             `json:"type"`
+		Error *streamErrorDetail `json:"error"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return 0, false
+	}
+	if payload.Type != "error" && event != "error" {
+		return 0, false
+	}
+	if payload.Error == nil {
+		return http.StatusInternalServerError, true
+	}
+	return payload.Error.statusCode(), true
+}
+
+// parseGeminiStreamError recognizes a stream chunk carrying {"error": {"code": ..., "status": ...}}.
+func parseGeminiStreamError(data []byte) (int, bool) {
+	var payload struct {
+		Error *streamErrorDetail `json:"error"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil || payload.Error == nil {
+		return 0, false
+	}
+	return payload.Error.statusCode(), true
+}
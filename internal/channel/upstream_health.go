@@ -0,0 +1,214 @@
+package channel
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// circuitState is the state of an upstream's circuit breaker.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// upstreamHealth tracks consecutive failures of an upstream and its circuit breaker state.
+type upstreamHealth struct {
+	state               circuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	probeStartedAt      time.Time
+}
+
+// healthCheckTimeout bounds a single active health check request.
+const healthCheckTimeout = 10 * time.Second
+
+// isAvailable reports whether the upstream may receive a request, moving an expired open circuit to half-open.
+// Must be called with upstreamLock held.
+func (b *BaseChannel) isAvailable(up *UpstreamInfo, now time.Time) bool {
+	openDuration := time.Duration(b.effectiveConfig.UpstreamCircuitOpenSeconds) * time.Second
+
+	switch up.health.state {
+	case circuitOpen:
+		if now.Sub(up.health.openedAt) < openDuration {
+			return false
+		}
+		up.health.state = circuitHalfOpen
+		up.health.probeStartedAt = time.Time{}
+		return true
+	case circuitHalfOpen:
+		// Only one probe at a time; a probe that never reported back is replaced after the open duration.
+		return up.health.probeStartedAt.IsZero() || now.Sub(up.health.probeStartedAt) >= openDuration
+	default:
+		return true
+	}
+}
+
+// findUpstream returns the upstream the URL was built from, preferring the longest matching base URL.
+// Must be called with upstreamLock held.
+func (b *BaseChannel) findUpstream(upstreamURL string) *UpstreamInfo {
+	var found *UpstreamInfo
+	longest := -1
+	for i := range b.Upstreams {
+		base := b.Upstreams[i].URL.String()
+		if strings.HasPrefix(upstreamURL, base) && len(base) > longest {
+			found = &b.Upstreams[i]
+			longest = len(base)
+		}
+	}
+	return found
+}
+
+// MarkUpstreamSuccess records that the upstream answered a request after the given latency, closing its circuit.
+func (b *BaseChannel) MarkUpstreamSuccess(upstreamURL string, latency time.Duration) {
+	b.upstreamLock.Lock()
+	defer b.upstreamLock.Unlock()
+
+	if up := b.findUpstream(upstreamURL); up != nil {
+		b.markSuccess(up)
+		up.recordLatency(latency)
+	}
+}
+
+// MarkUpstreamFailure records a connection error or 5xx response of the upstream.
+// It returns true when health tracking is enabled and another upstream can take the retry,
+// meaning the failure is attributed to the upstream rather than the key.
+func (b *BaseChannel) MarkUpstreamFailure(upstreamURL string) bool {
+	if b.effectiveConfig.UpstreamFailureThreshold <= 0 {
+		return false
+	}
+
+	b.upstreamLock.Lock()
+	defer b.upstreamLock.Unlock()
+
+	up := b.findUpstream(upstreamURL)
+	if up == nil {
+		return false
+	}
+	b.markFailure(up)
+
+	// With no other upstream to fail over to, the key stays the only thing a retry can change.
+	now := time.Now()
+	for i := range b.Upstreams {
+		if other := &b.Upstreams[i]; other != up && b.isAvailable(other, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// markSuccess must be called with upstreamLock held.
+func (b *BaseChannel) markSuccess(up *UpstreamInfo) {
+	if up.health.state != circuitClosed {
+		logrus.Infof("Upstream %s of channel %s has recovered, closing circuit", up.URL.Redacted(), b.Name)
+	}
+	up.health = upstreamHealth{}
+}
+
+// markFailure must be called with upstreamLock held.
+func (b *BaseChannel) markFailure(up *UpstreamInfo) {
+	threshold := b.effectiveConfig.UpstreamFailureThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	up.health.consecutiveFailures++
+	if up.health.state == circuitHalfOpen || (up.health.state == circuitClosed && up.health.consecutiveFailures >= threshold) {
+		logrus.Warnf("Upstream %s of channel %s is unhealthy after %d consecutive failures, opening circuit", up.URL.Redacted(), b.Name, up.health.consecutiveFailures)
+		up.health.state = circuitOpen
+		up.health.openedAt = time.Now()
+		up.health.probeStartedAt = time.Time{}
+	}
+}
+
+// startHealthCheck periodically probes every upstream when an active health check path is configured.
+func (b *BaseChannel) startHealthCheck() {
+	path := b.effectiveConfig.UpstreamHealthCheckPath
+	if path == "" || b.effectiveConfig.UpstreamFailureThreshold <= 0 {
+		return
+	}
+
+	b.healthCheckStop = make(chan struct{})
+	interval := time.Duration(b.effectiveConfig.UpstreamHealthCheckIntervalSeconds) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.runHealthCheck(path)
+			case <-b.healthCheckStop:
+				return
+			}
+		}
+	}()
+}
+
+// runHealthCheck probes all upstreams concurrently and records the results.
+func (b *BaseChannel) runHealthCheck(path string) {
+	var wg sync.WaitGroup
+	for i := range b.Upstreams {
+		checkURL := strings.TrimRight(b.Upstreams[i].URL.String(), "/") + path
+		wg.Add(1)
+		go func(up *UpstreamInfo) {
+			defer wg.Done()
+			healthy := b.probeUpstream(checkURL)
+
+			b.upstreamLock.Lock()
+			defer b.upstreamLock.Unlock()
+			if healthy {
+				b.markSuccess(up)
+			} else {
+				b.markFailure(up)
+			}
+		}(&b.Upstreams[i])
+	}
+	wg.Wait()
+}
+
+// probeUpstream sends a health check request; any response below 500 means the upstream is reachable.
+func (b *BaseChannel) probeUpstream(checkURL string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := b.HTTPClient.Do(req)
+	if err != nil {
+		logrus.Debugf("Health check of %s failed: %v", checkURL, err)
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+// StopHealthCheck stops the active health check of a channel that is being replaced.
+func (b *BaseChannel) StopHealthCheck() {
+	b.healthCheckOnce.Do(func() {
+		if b.healthCheckStop != nil {
+			close(b.healthCheckStop)
+		}
+	})
+}
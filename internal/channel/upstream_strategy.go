@@ -0,0 +1,149 @@
+package channel
+
+import "time"
+
+// Upstream selection strategies, configured per group with the upstream_strategy setting.
+const (
+	UpstreamStrategyWeightedRoundRobin = "weighted_round_robin"
+	UpstreamStrategyLeastInFlight      = "least_inflight"
+	UpstreamStrategyLowestLatency      = "lowest_latency"
+	UpstreamStrategyPriority           = "priority"
+)
+
+// latencyEWMAAlpha is the weight of the newest sample in the latency moving average.
+const latencyEWMAAlpha = 0.3
+
+// UpstreamStatus describes the selection strategy of a channel and the live state of its upstreams.
+type UpstreamStatus struct {
+	Strategy  string         `json:"strategy"`
+	Upstreams []UpstreamStat `json:"upstreams"`
+}
+
+// UpstreamStat is the observed state of a single upstream.
+type UpstreamStat struct {
+	URL                 string  `json:"url"`
+	Weight              int     `json:"weight"`
+	Priority            int     `json:"priority"`
+	State               string  `json:"state"`
+	InFlight            int     `json:"in_flight"`
+	LatencyMs           float64 `json:"latency_ms"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+}
+
+// pickUpstream applies the configured strategy to the available upstreams.
+func (b *BaseChannel) pickUpstream(candidates []*UpstreamInfo) *UpstreamInfo {
+	switch b.effectiveConfig.UpstreamStrategy {
+	case UpstreamStrategyLeastInFlight:
+		return pickLeastInFlight(candidates)
+	case UpstreamStrategyLowestLatency:
+		return pickLowestLatency(candidates)
+	case UpstreamStrategyPriority:
+		return pickWeightedRoundRobin(highestPriority(candidates))
+	default:
+		return pickWeightedRoundRobin(candidates)
+	}
+}
+
+// pickWeightedRoundRobin is the smooth weighted round-robin algorithm.
+func pickWeightedRoundRobin(candidates []*UpstreamInfo) *UpstreamInfo {
+	totalWeight := 0
+	var best *UpstreamInfo
+
+	for _, up := range candidates {
+		totalWeight += up.Weight
+		up.CurrentWeight += up.Weight
+
+		if best == nil || up.CurrentWeight > best.CurrentWeight {
+			best = up
+		}
+	}
+
+	if best != nil {
+		best.CurrentWeight -= totalWeight
+	}
+	return best
+}
+
+// pickLeastInFlight picks the upstream with the fewest in-flight requests relative to its weight.
+func pickLeastInFlight(candidates []*UpstreamInfo) *UpstreamInfo {
+	var best *UpstreamInfo
+	for _, up := range candidates {
+		// Compare inFlight/weight without division.
+		if best == nil || up.inFlight*best.Weight < best.inFlight*up.Weight {
+			best = up
+		}
+	}
+	return best
+}
+
+// pickLowestLatency picks the upstream with the lowest average latency; upstreams without samples are tried first.
+func pickLowestLatency(candidates []*UpstreamInfo) *UpstreamInfo {
+	var best *UpstreamInfo
+	for _, up := range candidates {
+		if best == nil || up.latency < best.latency {
+			best = up
+		}
+	}
+	return best
+}
+
+// highestPriority returns the candidates sharing the lowest priority value.
+func highestPriority(candidates []*UpstreamInfo) []*UpstreamInfo {
+	var result []*UpstreamInfo
+	for _, up := range candidates {
+		switch {
+		case len(result) == 0 || up.Priority < result[0].Priority:
+			result = []*UpstreamInfo{up}
+		case up.Priority == result[0].Priority:
+			result = append(result, up)
+		}
+	}
+	return result
+}
+
+// recordLatency folds a latency sample into the upstream's moving average.
+// Must be called with upstreamLock held.
+func (up *UpstreamInfo) recordLatency(latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	if up.latency == 0 {
+		up.latency = latency
+		return
+	}
+	up.latency = time.Duration(latencyEWMAAlpha*float64(latency) + (1-latencyEWMAAlpha)*float64(up.latency))
+}
+
+// ReleaseUpstream marks a request to the upstream of the given URL as finished.
+func (b *BaseChannel) ReleaseUpstream(upstreamURL string) {
+	b.upstreamLock.Lock()
+	defer b.upstreamLock.Unlock()
+
+	if up := b.findUpstream(upstreamURL); up != nil && up.inFlight > 0 {
+		up.inFlight--
+	}
+}
+
+// UpstreamStatus returns the selection strategy and a snapshot of every upstream's state.
+func (b *BaseChannel) UpstreamStatus() UpstreamStatus {
+	b.upstreamLock.Lock()
+	defer b.upstreamLock.Unlock()
+
+	strategy := b.effectiveConfig.UpstreamStrategy
+	if strategy == "" {
+		strategy = UpstreamStrategyWeightedRoundRobin
+	}
+	status := UpstreamStatus{Strategy: strategy, Upstreams: make([]UpstreamStat, 0, len(b.Upstreams))}
+	for _, up := range b.Upstreams {
+		status.Upstreams = append(status.Upstreams, UpstreamStat{
+			URL:                 up.URL.Redacted(),
+			Weight:              up.Weight,
+			Priority:            up.Priority,
+			State:               up.health.state.String(),
+			InFlight:            up.inFlight,
+			LatencyMs:           float64(up.latency.Microseconds()) / 1000,
+			ConsecutiveFailures: up.health.consecutiveFailures,
+		})
+	}
+	return status
+}
@@ -0,0 +1,138 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"gpt-load/internal/models"
+)
+
+// openAIUsage matches the usage block of the Chat Completions, Responses and Realtime APIs.
+type openAIUsage struct {
+	PromptTokens        int64 `json:"prompt_tokens"`
+	CompletionTokens    int64 `json:"completion_tokens"`
+	InputTokens         int64 `json:"input_tokens"`
+	OutputTokens        int64 `json:"output_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	InputTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	// The Realtime API names the same block input_token_details.
+	InputTokenDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"input_token_details"`
+}
+
+func (u *openAIUsage) toTokenUsage() *models.TokenUsage {
+	return &models.TokenUsage{
+		InputTokens:  u.PromptTokens + u.InputTokens,
+		OutputTokens: u.CompletionTokens + u.OutputTokens,
+		CachedTokens: u.PromptTokensDetails.CachedTokens + u.InputTokensDetails.CachedTokens + u.InputTokenDetails.CachedTokens,
+	}
+}
+
+// parseOpenAIUsage extracts usage from an OpenAI response body or stream chunk.
+// Responses API stream events nest the final usage under "response".
+func parseOpenAIUsage(data []byte) *models.TokenUsage {
+	var payload struct {
+		Usage    *openAIUsage `json:"usage"`
+		Response *struct {
+			Usage *openAIUsage `json:"usage"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil
+	}
+	if payload.Usage != nil {
+		return payload.Usage.toTokenUsage()
+	}
+	if payload.Response != nil && payload.Response.Usage != nil {
+		return payload.Response.Usage.toTokenUsage()
+	}
+	return nil
+}
+
+// anthropicUsage matches the usage block of the Anthropic Messages API.
+type anthropicUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// toTokenUsage reports cache reads and writes as part of the input, matching OpenAI's prompt_tokens semantics.
+func (u *anthropicUsage) toTokenUsage() *models.TokenUsage {
+	return &models.TokenUsage{
+		InputTokens:  u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens: u.OutputTokens,
+		CachedTokens: u.CacheReadInputTokens,
+	}
+}
+
+// parseAnthropicUsage extracts usage from a message body, a message_start event or a message_delta event.
+func parseAnthropicUsage(data []byte) *models.TokenUsage {
+	var payload struct {
+		Usage   *anthropicUsage `json:"usage"`
+		Message *struct {
+			Usage *anthropicUsage `json:"usage"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil
+	}
+	if payload.Usage != nil {
+		return payload.Usage.toTokenUsage()
+	}
+	if payload.Message != nil && payload.Message.Usage != nil {
+		return payload.Message.Usage.toTokenUsage()
+	}
+	return nil
+}
+
+// geminiUsageMetadata matches the usageMetadata block of the Gemini generateContent API.
+type geminiUsageMetadata struct {
+	PromptTokenCount        int64 `json:"promptTokenCount"`
+	CandidatesTokenCount    int64 `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int64 `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int64 `json:"cachedContentTokenCount"`
+}
+
+// parseGeminiUsage extracts usageMetadata from a response object or, for the
+// non-SSE streamGenerateContent format, from the last element of a response array.
+func parseGeminiUsage(data []byte) *models.TokenUsage {
+	type geminiPayload struct {
+		UsageMetadata *geminiUsageMetadata `json:"usageMetadata"`
+	}
+
+	var payloads []geminiPayload
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &payloads); err != nil {
+			return nil
+		}
+	} else {
+		var p geminiPayload
+		if err := json.Unmarshal(trimmed, &p); err != nil {
+			return nil
+		}
+		payloads = append(payloads, p)
+	}
+
+	var usage *models.TokenUsage
+	for _, p := range payloads {
+		if p.UsageMetadata == nil {
+			continue
+		}
+		if usage == nil {
+			usage = &models.TokenUsage{}
+		}
+		usage.Merge(&models.TokenUsage{
+			InputTokens:  p.UsageMetadata.PromptTokenCount,
+			OutputTokens: p.UsageMetadata.CandidatesTokenCount + p.UsageMetadata.ThoughtsTokenCount,
+			CachedTokens: p.UsageMetadata.CachedContentTokenCount,
+		})
+	}
+	return usage
+}
@@ -12,8 +12,11 @@ import (
 	"gpt-load/internal/utils"
 	"os"
 	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/datatypes"
@@ -280,15 +283,8 @@ func (sm *SystemSettingsManager) ValidateSettings(settingsMap map[string]any) er
 			}
 
 			// The 'required' check is implicitly handled by the type assertion above.
-			for _, rule := range rules {
-				trimmedRule := strings.TrimSpace(rule)
-				if strings.HasPrefix(trimmedRule, "min=") {
-					minValStr := strings.TrimPrefix(trimmedRule, "min=")
-					minVal, _ := strconv.Atoi(minValStr)
-					if intVal < minVal {
-						return fmt.Errorf("value for %s (%d) is below minimum value (%d)", key, intVal, minVal)
-					}
-				}
+			if err := validateIntRules(key, intVal, rules); err != nil {
+				return err
 			}
 		case reflect.Bool:
 			if _, ok := value.(bool); !ok {
@@ -299,13 +295,8 @@ func (sm *SystemSettingsManager) ValidateSettings(settingsMap map[string]any) er
 			if !ok {
 				return fmt.Errorf("invalid type for %s: expected a string, got %T", key, value)
 			}
-			for _, rule := range rules {
-				trimmedRule := strings.TrimSpace(rule)
-				if trimmedRule == "required" {
-					if strVal == "" {
-						return fmt.Errorf("value for %s is required", key)
-					}
-				}
+			if err := validateStringRules(key, strVal, rules); err != nil {
+				return err
 			}
 		default:
 			return fmt.Errorf("unsupported type for setting key validation: %s", key)
@@ -354,28 +345,16 @@ func (sm *SystemSettingsManager) ValidateGroupConfigOverrides(configMap map[stri
 			}
 
 			// The 'required' check is implicitly handled by the type assertion above.
-			for _, rule := range rules {
-				trimmedRule := strings.TrimSpace(rule)
-				if strings.HasPrefix(trimmedRule, "min=") {
-					minValStr := strings.TrimPrefix(trimmedRule, "min=")
-					minVal, _ := strconv.Atoi(minValStr)
-					if intVal < minVal {
-						return fmt.Errorf("value for %s (%d) is below minimum value (%d)", key, intVal, minVal)
-					}
-				}
+			if err := validateIntRules(key, intVal, rules); err != nil {
+				return err
 			}
 		case reflect.String:
 			strVal, ok := value.(string)
 			if !ok {
 				continue
 			}
-			for _, rule := range rules {
-				trimmedRule := strings.TrimSpace(rule)
-				if trimmedRule == "required" {
-					if strVal == "" {
-						return fmt.Errorf("value for %s is required", key)
-					}
-				}
+			if err := validateStringRules(key, strVal, rules); err != nil {
+				return err
 			}
 		default:
 			// Do not validate other types for group overrides
@@ -385,6 +364,56 @@ func (sm *SystemSettingsManager) ValidateGroupConfigOverrides(configMap map[stri
 	return nil
 }
 
+// validateIntRules checks an integer setting against the rules of its validate tag.
+func validateIntRules(key string, intVal int, rules []string) error {
+	for _, rule := range rules {
+		trimmedRule := strings.TrimSpace(rule)
+		if strings.HasPrefix(trimmedRule, "min=") {
+			minValStr := strings.TrimPrefix(trimmedRule, "min=")
+			minVal, _ := strconv.Atoi(minValStr)
+			if intVal < minVal {
+				return fmt.Errorf("value for %s (%d) is below minimum value (%d)", key, intVal, minVal)
+			}
+		}
+	}
+	return nil
+}
+
+// validateStringRules checks a string setting against the rules of its validate tag.
+func validateStringRules(key, strVal string, rules []string) error {
+	for _, rule := range rules {
+		trimmedRule := strings.TrimSpace(rule)
+		switch {
+		case trimmedRule == "required":
+			if strVal == "" {
+				return fmt.Errorf("value for %s is required", key)
+			}
+		case trimmedRule == "status_codes":
+			if _, err := utils.ParseStatusCodeRanges(strVal); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", key, err)
+			}
+		case trimmedRule == "timezone":
+			if _, err := time.LoadLocation(strVal); err != nil {
+				return fmt.Errorf("invalid time zone for %s: %s", key, strVal)
+			}
+		case trimmedRule == "regex":
+			if _, err := regexp.Compile(strVal); err != nil {
+				return fmt.Errorf("invalid regular expression for %s: %w", key, err)
+			}
+		case trimmedRule == "model_rules":
+			if _, err := utils.ParseProxyKeyModelRules(strVal); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", key, err)
+			}
+		case strings.HasPrefix(trimmedRule, "oneof="):
+			options := strings.Fields(strings.TrimPrefix(trimmedRule, "oneof="))
+			if !slices.Contains(options, strVal) {
+				return fmt.Errorf("value for %s must be one of: %s", key, strings.Join(options, ", "))
+			}
+		}
+	}
+	return nil
+}
+
 // DisplaySystemConfig displays the current system settings.
 func (sm *SystemSettingsManager) DisplaySystemConfig(settings types.SystemSettings) {
 	logrus.Info("")
@@ -398,6 +427,8 @@ func (sm *SystemSettingsManager) DisplaySystemConfig(settings types.SystemSettin
 	logrus.Infof("    Request Timeout: %d seconds", settings.RequestTimeout)
 	logrus.Infof("    Connect Timeout: %d seconds", settings.ConnectTimeout)
 	logrus.Infof("    Response Header Timeout: %d seconds", settings.ResponseHeaderTimeout)
+	logrus.Infof("    Stream First Byte Timeout: %d seconds", settings.StreamFirstByteTimeout)
+	logrus.Infof("    Stream Idle Timeout: %d seconds", settings.StreamIdleTimeout)
 	logrus.Infof("    Idle Connection Timeout: %d seconds", settings.IdleConnTimeout)
 	logrus.Infof("    Max Idle Connections: %d", settings.MaxIdleConns)
 	logrus.Infof("    Max Idle Connections Per Host: %d", settings.MaxIdleConnsPerHost)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Stats Get dashboard statistics
@@ -106,8 +107,10 @@ func (s *Server) Stats(c *gin.Context) {
 }
 
 // Chart Get dashboard chart data
+// The optional "metric" query parameter selects between request counts (default) and token usage ("tokens").
 func (s *Server) Chart(c *gin.Context) {
 	groupID := c.Query("groupId")
+	metric := c.DefaultQuery("metric", "requests")
 
 	now := time.Now()
 	endHour := now.Truncate(time.Hour)
@@ -117,6 +120,8 @@ func (s *Server) Chart(c *gin.Context) {
 	query := s.DB.Where("time >= ? AND time < ?", startHour, endHour.Add(time.Hour))
 	if groupID != "" {
 		query = query.Where("group_id = ?", groupID)
+	} else {
+		query = query.Scopes(s.excludeAggregateGroups)
 	}
 	if err := query.Order("time asc").Find(&hourlyStats).Error; err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, "failed to get chart data"))
@@ -131,38 +136,39 @@ func (s *Server) Chart(c *gin.Context) {
 		}
 		statsByHour[hour]["success"] += stat.SuccessCount
 		statsByHour[hour]["failure"] += stat.FailureCount
+		statsByHour[hour]["input_tokens"] += stat.InputTokens
+		statsByHour[hour]["output_tokens"] += stat.OutputTokens
+		statsByHour[hour]["cached_tokens"] += stat.CachedTokens
 	}
 
-	var labels []string
-	var successData, failureData []int64
+	fields := []string{"success", "failure"}
+	series := []models.ChartDataset{
+		{Label: "成功请求", Color: "rgba(10, 200, 110, 1)"},
+		{Label: "失败请求", Color: "rgba(255, 70, 70, 1)"},
+	}
+	if metric == "tokens" {
+		fields = []string{"input_tokens", "output_tokens", "cached_tokens"}
+		series = []models.ChartDataset{
+			{Label: "输入Token", Color: "rgba(24, 144, 255, 1)"},
+			{Label: "输出Token", Color: "rgba(250, 140, 22, 1)"},
+			{Label: "缓存Token", Color: "rgba(114, 46, 209, 1)"},
+		}
+	}
 
+	var labels []string
 	for i := range 24 {
 		hour := startHour.Add(time.Duration(i) * time.Hour)
 		labels = append(labels, hour.Format(time.RFC3339))
 
-		if data, ok := statsByHour[hour]; ok {
-			successData = append(successData, data["success"])
-			failureData = append(failureData, data["failure"])
-		} else {
-			successData = append(successData, 0)
-			failureData = append(failureData, 0)
+		data := statsByHour[hour]
+		for j, field := range fields {
+			series[j].Data = append(series[j].Data, data[field])
 		}
 	}
 
 	chartData := models.ChartData{
-		Labels: labels,
-		Datasets: []models.ChartDataset{
-			{
-				Label: "成功请求",
-				Data:  successData,
-				Color: "rgba(10, 200, 110, 1)",
-			},
-			{
-				Label: "失败请求",
-				Data:  failureData,
-				Color: "rgba(255, 70, 70, 1)",
-			},
-		},
+		Labels:   labels,
+		Datasets: series,
 	}
 
 	response.Success(c, chartData)
@@ -178,10 +184,16 @@ func (s *Server) getHourlyStats(startTime, endTime time.Time) (hourlyStatResult,
 	err := s.DB.Model(&models.GroupHourlyStat{}).
 		Select("sum(success_count) + sum(failure_count) as total_requests, sum(failure_count) as total_failures").
 		Where("time >= ? AND time < ?", startTime, endTime).
+		Scopes(s.excludeAggregateGroups).
 		Scan(&result).Error
 	return result, err
 }
 
+// excludeAggregateGroups skips the hourly stats of aggregate groups, which duplicate those of their members.
+func (s *Server) excludeAggregateGroups(db *gorm.DB) *gorm.DB {
+	return db.Where("group_id NOT IN (?)", s.DB.Model(&models.Group{}).Select("id").Where("group_type = ?", models.GroupTypeAggregate))
+}
+
 type rpmStatResult struct {
 	CurrentRequests  int64
 	PreviousRequests int64
@@ -14,11 +14,13 @@ import (
 	"gpt-load/internal/utils"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"gpt-load/internal/channel"
+	"gpt-load/internal/proxy"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -36,10 +38,44 @@ func isValidChannelType(channelType string) bool {
 	return false
 }
 
+// validateInboundFormat checks that the inbound format can be served by the channel type.
+func validateInboundFormat(inboundFormat, channelType string) error {
+	if proxy.IsSupportedInboundFormat(inboundFormat, channelType) {
+		return nil
+	}
+	supported := proxy.SupportedInboundFormats(channelType)
+	if len(supported) == 0 {
+		return fmt.Errorf("channel type '%s' does not support an inbound format other than its native one", channelType)
+	}
+	return fmt.Errorf("invalid inbound format '%s' for channel type '%s'. Supported formats are: %s", inboundFormat, channelType, strings.Join(supported, ", "))
+}
+
+// validatePlugins checks the ordered plugin list of a group and returns it as JSON.
+// Built-in steps that the list leaves out still run before the listed plugins.
+func validatePlugins(plugins []models.PluginConfig) (datatypes.JSON, error) {
+	cleaned := make([]models.PluginConfig, 0, len(plugins))
+	for _, plugin := range plugins {
+		plugin.Name = strings.TrimSpace(plugin.Name)
+		if plugin.Name == "" {
+			continue
+		}
+		cleaned = append(cleaned, plugin)
+	}
+	if err := proxy.ValidatePlugins(cleaned); err != nil {
+		return nil, err
+	}
+	pluginsJSON, err := json.Marshal(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process plugins: %w", err)
+	}
+	return pluginsJSON, nil
+}
+
 // UpstreamDefinition defines the structure for an upstream in the request.
 type UpstreamDefinition struct {
-	URL    string `json:"url"`
-	Weight int    `json:"weight"`
+	URL      string `json:"url"`
+	Weight   int    `json:"weight"`
+	Priority int    `json:"priority,omitempty"` // 数值越小越优先，仅 priority 策略使用
 }
 
 // validateAndCleanUpstreams validates and cleans the upstreams JSON.
@@ -69,6 +105,9 @@ func validateAndCleanUpstreams(upstreams json.RawMessage) (datatypes.JSON, error
 		if defs[i].Weight <= 0 {
 			return nil, fmt.Errorf("upstream weight must be a positive integer")
 		}
+		if defs[i].Priority < 0 {
+			return nil, fmt.Errorf("upstream priority cannot be negative")
+		}
 	}
 
 	cleanedUpstreams, err := json.Marshal(defs)
@@ -79,6 +118,177 @@ func validateAndCleanUpstreams(upstreams json.RawMessage) (datatypes.JSON, error
 	return cleanedUpstreams, nil
 }
 
+// validateModelMapping trims the aliases and ensures every alias maps to a model name.
+func validateModelMapping(mapping map[string]any) (datatypes.JSONMap, error) {
+	cleaned := make(datatypes.JSONMap, len(mapping))
+	for alias, target := range mapping {
+		alias = strings.TrimSpace(alias)
+		model, ok := target.(string)
+		model = strings.TrimSpace(model)
+		if alias == "" || !ok || model == "" {
+			return nil, fmt.Errorf("invalid model mapping for '%s': the target must be a non-empty model name", alias)
+		}
+		cleaned[alias] = model
+	}
+	return cleaned, nil
+}
+
+// validateParamRules checks the param rules of a group and returns them as JSON.
+func validateParamRules(rules []models.ParamRule) (datatypes.JSON, error) {
+	cleaned := make([]models.ParamRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.Path = strings.TrimSpace(rule.Path)
+		rule.Action = strings.TrimSpace(rule.Action)
+		if rule.Path == "" || slices.Contains(strings.Split(rule.Path, "."), "") {
+			return nil, fmt.Errorf("param rule %d: invalid path '%s'", i+1, rule.Path)
+		}
+
+		switch rule.Action {
+		case models.ParamActionSet, models.ParamActionDefault:
+			if len(rule.Value) == 0 {
+				return nil, fmt.Errorf("param rule %d: action '%s' requires a value", i+1, rule.Action)
+			}
+			if !json.Valid(rule.Value) {
+				return nil, fmt.Errorf("param rule %d: value is not valid JSON", i+1)
+			}
+		case models.ParamActionDelete:
+			rule.Value = nil
+		case models.ParamActionClamp:
+			if rule.Min == nil && rule.Max == nil {
+				return nil, fmt.Errorf("param rule %d: action 'clamp' requires min or max", i+1)
+			}
+			if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+				return nil, fmt.Errorf("param rule %d: min must not be greater than max", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("param rule %d: invalid action '%s'. Supported actions are: set, default, delete, clamp", i+1, rule.Action)
+		}
+		if rule.Action != models.ParamActionClamp {
+			rule.Min, rule.Max = nil, nil
+		}
+
+		rule.Models = cleanPatterns(rule.Models)
+		rule.Paths = cleanPatterns(rule.Paths)
+		cleaned = append(cleaned, rule)
+	}
+
+	rulesJSON, err := json.Marshal(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process param rules: %w", err)
+	}
+	return rulesJSON, nil
+}
+
+// validateModelFallbacks checks the fallback chains of a group and returns them as JSON.
+func validateModelFallbacks(fallbacks []models.ModelFallback) (datatypes.JSON, error) {
+	cleaned := make([]models.ModelFallback, 0, len(fallbacks))
+	for i, fallback := range fallbacks {
+		fallback.Model = strings.TrimSpace(fallback.Model)
+		if fallback.Model == "" {
+			return nil, fmt.Errorf("model fallback %d: model is required", i+1)
+		}
+		targets := make([]string, 0, len(fallback.Fallbacks))
+		for _, target := range fallback.Fallbacks {
+			target = strings.TrimSpace(target)
+			if target == "" || strings.HasPrefix(target, "/") || strings.HasSuffix(target, "/") {
+				return nil, fmt.Errorf("model fallback %d: invalid fallback '%s', use a model name or group/model", i+1, target)
+			}
+			if !slices.Contains(targets, target) {
+				targets = append(targets, target)
+			}
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("model fallback %d: at least one fallback is required for '%s'", i+1, fallback.Model)
+		}
+		fallback.Fallbacks = targets
+		cleaned = append(cleaned, fallback)
+	}
+
+	fallbacksJSON, err := json.Marshal(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process model fallbacks: %w", err)
+	}
+	return fallbacksJSON, nil
+}
+
+// cleanPatterns trims glob patterns and drops empty ones.
+func cleanPatterns(patterns []string) []string {
+	var cleaned []string
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			cleaned = append(cleaned, pattern)
+		}
+	}
+	return cleaned
+}
+
+// validateSubGroups checks the members of an aggregate group. Members must be standard groups
+// that accept the same API format as the aggregate's channel type.
+func (s *Server) validateSubGroups(aggregateID uint, channelType string, subGroups []models.SubGroup) (datatypes.JSON, error) {
+	if len(subGroups) == 0 {
+		return nil, fmt.Errorf("an aggregate group requires at least one sub group")
+	}
+
+	seen := make(map[uint]bool, len(subGroups))
+	ids := make([]uint, 0, len(subGroups))
+	for _, sg := range subGroups {
+		if sg.GroupID == 0 || sg.GroupID == aggregateID {
+			return nil, fmt.Errorf("invalid sub group ID: %d", sg.GroupID)
+		}
+		if seen[sg.GroupID] {
+			return nil, fmt.Errorf("duplicate sub group ID: %d", sg.GroupID)
+		}
+		if sg.Weight <= 0 {
+			return nil, fmt.Errorf("sub group weight must be a positive integer")
+		}
+		if sg.Priority < 0 {
+			return nil, fmt.Errorf("sub group priority cannot be negative")
+		}
+		seen[sg.GroupID] = true
+		ids = append(ids, sg.GroupID)
+	}
+
+	var members []models.Group
+	if err := s.DB.Where("id IN ?", ids).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) != len(ids) {
+		return nil, fmt.Errorf("one or more sub groups do not exist")
+	}
+	for _, member := range members {
+		if member.IsAggregate() {
+			return nil, fmt.Errorf("sub group '%s' is an aggregate group; aggregate groups cannot be nested", member.Name)
+		}
+		if memberFormat := member.ClientFormat(); memberFormat != channelType {
+			return nil, fmt.Errorf("sub group '%s' accepts the '%s' format, which does not match channel type '%s'", member.Name, memberFormat, channelType)
+		}
+	}
+
+	return json.Marshal(subGroups)
+}
+
+// findParentAggregates returns the aggregate groups that list the given group as a member.
+func (s *Server) findParentAggregates(memberID uint) ([]models.Group, error) {
+	var aggregates []models.Group
+	if err := s.DB.Where("group_type = ?", models.GroupTypeAggregate).Find(&aggregates).Error; err != nil {
+		return nil, err
+	}
+	var parents []models.Group
+	for _, aggregate := range aggregates {
+		var subGroups []models.SubGroup
+		if err := json.Unmarshal(aggregate.SubGroups, &subGroups); err != nil {
+			continue
+		}
+		for _, sg := range subGroups {
+			if sg.GroupID == memberID {
+				parents = append(parents, aggregate)
+				break
+			}
+		}
+	}
+	return parents, nil
+}
+
 // isValidGroupName checks if the group name is valid.
 func isValidGroupName(name string) bool {
 	if name == "" {
@@ -157,18 +367,25 @@ func (s *Server) validateAndCleanConfig(configMap map[string]any) (map[string]an
 
 // GroupCreateRequest defines the payload for creating a group.
 type GroupCreateRequest struct {
-	Name               string              `json:"name"`
-	DisplayName        string              `json:"display_name"`
-	Description        string              `json:"description"`
-	Upstreams          json.RawMessage     `json:"upstreams"`
-	ChannelType        string              `json:"channel_type"`
-	Sort               int                 `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint string              `json:"validation_endpoint"`
-	ParamOverrides     map[string]any      `json:"param_overrides"`
-	Config             map[string]any      `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          string              `json:"proxy_keys"`
+	Name               string                 `json:"name"`
+	GroupType          string                 `json:"group_type"`
+	DisplayName        string                 `json:"display_name"`
+	Description        string                 `json:"description"`
+	Upstreams          json.RawMessage        `json:"upstreams"`
+	SubGroups          []models.SubGroup      `json:"sub_groups"`
+	ChannelType        string                 `json:"channel_type"`
+	InboundFormat      string                 `json:"inbound_format"`
+	Sort               int                    `json:"sort"`
+	TestModel          string                 `json:"test_model"`
+	ValidationEndpoint string                 `json:"validation_endpoint"`
+	ParamOverrides     map[string]any         `json:"param_overrides"`
+	ParamRules         []models.ParamRule     `json:"param_rules"`
+	ModelMapping       map[string]any         `json:"model_mapping"`
+	ModelFallbacks     []models.ModelFallback `json:"model_fallbacks"`
+	Config             map[string]any         `json:"config"`
+	HeaderRules        []models.HeaderRule    `json:"header_rules"`
+	Plugins            []models.PluginConfig  `json:"plugins"`
+	ProxyKeys          string                 `json:"proxy_keys"`
 }
 
 // CreateGroup handles the creation of a new group.
@@ -193,18 +410,49 @@ func (s *Server) CreateGroup(c *gin.Context) {
 		return
 	}
 
-	testModel := strings.TrimSpace(req.TestModel)
-	if testModel == "" {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Test model is required"))
+	groupType := strings.TrimSpace(req.GroupType)
+	if groupType == "" {
+		groupType = models.GroupTypeStandard
+	}
+	if groupType != models.GroupTypeStandard && groupType != models.GroupTypeAggregate {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Invalid group type. Supported types are: standard, aggregate"))
 		return
 	}
 
-	cleanedUpstreams, err := validateAndCleanUpstreams(req.Upstreams)
-	if err != nil {
+	inboundFormat := strings.TrimSpace(req.InboundFormat)
+	if err := validateInboundFormat(inboundFormat, channelType); err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 		return
 	}
 
+	testModel := strings.TrimSpace(req.TestModel)
+	var cleanedUpstreams, subGroupsJSON datatypes.JSON
+	var err error
+	if groupType == models.GroupTypeAggregate {
+		// 聚合分组不直接连接上游，请求由成员分组处理
+		if inboundFormat != "" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Aggregate groups do not support an inbound format; configure it on the member groups instead"))
+			return
+		}
+		subGroupsJSON, err = s.validateSubGroups(0, channelType, req.SubGroups)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		cleanedUpstreams = datatypes.JSON("[]")
+	} else {
+		if testModel == "" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Test model is required"))
+			return
+		}
+
+		cleanedUpstreams, err = validateAndCleanUpstreams(req.Upstreams)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+	}
+
 	cleanedConfig, err := s.validateAndCleanConfig(req.Config)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid config format: %v", err)))
@@ -217,6 +465,24 @@ func (s *Server) CreateGroup(c *gin.Context) {
 		return
 	}
 
+	modelMapping, err := validateModelMapping(req.ModelMapping)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	paramRulesJSON, err := validateParamRules(req.ParamRules)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	modelFallbacksJSON, err := validateModelFallbacks(req.ModelFallbacks)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
 	// Validate and normalize header rules if provided
 	var headerRulesJSON datatypes.JSON
 	if len(req.HeaderRules) > 0 {
@@ -259,18 +525,31 @@ func (s *Server) CreateGroup(c *gin.Context) {
 		headerRulesJSON = datatypes.JSON("[]")
 	}
 
+	pluginsJSON, err := validatePlugins(req.Plugins)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
 	group := models.Group{
 		Name:               name,
+		GroupType:          groupType,
 		DisplayName:        strings.TrimSpace(req.DisplayName),
 		Description:        strings.TrimSpace(req.Description),
 		Upstreams:          cleanedUpstreams,
+		SubGroups:          subGroupsJSON,
 		ChannelType:        channelType,
+		InboundFormat:      inboundFormat,
 		Sort:               req.Sort,
 		TestModel:          testModel,
 		ValidationEndpoint: validationEndpoint,
 		ParamOverrides:     req.ParamOverrides,
+		ParamRules:         paramRulesJSON,
+		ModelMapping:       modelMapping,
+		ModelFallbacks:     modelFallbacksJSON,
 		Config:             cleanedConfig,
 		HeaderRules:        headerRulesJSON,
+		Plugins:            pluginsJSON,
 		ProxyKeys:          strings.TrimSpace(req.ProxyKeys),
 	}
 
@@ -304,18 +583,24 @@ func (s *Server) ListGroups(c *gin.Context) {
 // GroupUpdateRequest defines the payload for updating a group.
 // Using a dedicated struct avoids issues with zero values being ignored by GORM's Update.
 type GroupUpdateRequest struct {
-	Name               *string             `json:"name,omitempty"`
-	DisplayName        *string             `json:"display_name,omitempty"`
-	Description        *string             `json:"description,omitempty"`
-	Upstreams          json.RawMessage     `json:"upstreams"`
-	ChannelType        *string             `json:"channel_type,omitempty"`
-	Sort               *int                `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint *string             `json:"validation_endpoint,omitempty"`
-	ParamOverrides     map[string]any      `json:"param_overrides"`
-	Config             map[string]any      `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          *string             `json:"proxy_keys,omitempty"`
+	Name               *string                `json:"name,omitempty"`
+	DisplayName        *string                `json:"display_name,omitempty"`
+	Description        *string                `json:"description,omitempty"`
+	Upstreams          json.RawMessage        `json:"upstreams"`
+	SubGroups          []models.SubGroup      `json:"sub_groups"`
+	ChannelType        *string                `json:"channel_type,omitempty"`
+	InboundFormat      *string                `json:"inbound_format,omitempty"`
+	Sort               *int                   `json:"sort"`
+	TestModel          string                 `json:"test_model"`
+	ValidationEndpoint *string                `json:"validation_endpoint,omitempty"`
+	ParamOverrides     map[string]any         `json:"param_overrides"`
+	ParamRules         []models.ParamRule     `json:"param_rules"`
+	ModelMapping       map[string]any         `json:"model_mapping"`
+	ModelFallbacks     []models.ModelFallback `json:"model_fallbacks"`
+	Config             map[string]any         `json:"config"`
+	HeaderRules        []models.HeaderRule    `json:"header_rules"`
+	Plugins            []models.PluginConfig  `json:"plugins"`
+	ProxyKeys          *string                `json:"proxy_keys,omitempty"`
 }
 
 // UpdateGroup handles updating an existing group.
@@ -364,7 +649,7 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 		group.Description = strings.TrimSpace(*req.Description)
 	}
 
-	if req.Upstreams != nil {
+	if req.Upstreams != nil && !group.IsAggregate() {
 		cleanedUpstreams, err := validateAndCleanUpstreams(req.Upstreams)
 		if err != nil {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
@@ -382,10 +667,54 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 		}
 		group.ChannelType = cleanedChannelType
 	}
+	if req.InboundFormat != nil {
+		group.InboundFormat = strings.TrimSpace(*req.InboundFormat)
+	}
+	if req.ChannelType != nil || req.InboundFormat != nil {
+		if err := validateInboundFormat(group.InboundFormat, group.ChannelType); err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		if !group.IsAggregate() {
+			// 成员分组的格式变化后必须仍与所属聚合分组一致，否则拒绝修改
+			parents, err := s.findParentAggregates(group.ID)
+			if err != nil {
+				response.Error(c, app_errors.ParseDBError(err))
+				return
+			}
+			for _, parent := range parents {
+				if group.ClientFormat() != parent.ChannelType {
+					response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Group is a member of aggregate group '%s', which requires the '%s' format; remove it from the aggregate group first", parent.Name, parent.ChannelType)))
+					return
+				}
+			}
+		}
+	}
+	if group.IsAggregate() {
+		if group.InboundFormat != "" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Aggregate groups do not support an inbound format; configure it on the member groups instead"))
+			return
+		}
+		if req.SubGroups != nil || req.ChannelType != nil {
+			subGroups := req.SubGroups
+			if subGroups == nil && len(group.SubGroups) > 0 {
+				if err := json.Unmarshal(group.SubGroups, &subGroups); err != nil {
+					response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to parse sub groups: %v", err)))
+					return
+				}
+			}
+			subGroupsJSON, err := s.validateSubGroups(group.ID, group.ChannelType, subGroups)
+			if err != nil {
+				response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+				return
+			}
+			group.SubGroups = subGroupsJSON
+		}
+	}
 	if req.Sort != nil {
 		group.Sort = *req.Sort
 	}
-	if req.TestModel != "" {
+	if req.TestModel != "" && !group.IsAggregate() {
 		cleanedTestModel := strings.TrimSpace(req.TestModel)
 		if cleanedTestModel == "" {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Test model cannot be empty or just spaces."))
@@ -396,6 +725,30 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 	if req.ParamOverrides != nil {
 		group.ParamOverrides = req.ParamOverrides
 	}
+	if req.ParamRules != nil {
+		paramRulesJSON, err := validateParamRules(req.ParamRules)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		group.ParamRules = paramRulesJSON
+	}
+	if req.ModelMapping != nil {
+		modelMapping, err := validateModelMapping(req.ModelMapping)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		group.ModelMapping = modelMapping
+	}
+	if req.ModelFallbacks != nil {
+		modelFallbacksJSON, err := validateModelFallbacks(req.ModelFallbacks)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		group.ModelFallbacks = modelFallbacksJSON
+	}
 	if req.ValidationEndpoint != nil {
 		validationEndpoint := strings.TrimSpace(*req.ValidationEndpoint)
 		if !isValidValidationEndpoint(validationEndpoint) {
@@ -460,6 +813,15 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 		group.HeaderRules = headerRulesJSON
 	}
 
+	if req.Plugins != nil {
+		pluginsJSON, err := validatePlugins(req.Plugins)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		group.Plugins = pluginsJSON
+	}
+
 	// Save the updated group object
 	if err := tx.Save(&group).Error; err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
@@ -479,23 +841,30 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 
 // GroupResponse defines the structure for a group response, excluding sensitive or large fields.
 type GroupResponse struct {
-	ID                 uint                `json:"id"`
-	Name               string              `json:"name"`
-	Endpoint           string              `json:"endpoint"`
-	DisplayName        string              `json:"display_name"`
-	Description        string              `json:"description"`
-	Upstreams          datatypes.JSON      `json:"upstreams"`
-	ChannelType        string              `json:"channel_type"`
-	Sort               int                 `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint string              `json:"validation_endpoint"`
-	ParamOverrides     datatypes.JSONMap   `json:"param_overrides"`
-	Config             datatypes.JSONMap   `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          string              `json:"proxy_keys"`
-	LastValidatedAt    *time.Time          `json:"last_validated_at"`
-	CreatedAt          time.Time           `json:"created_at"`
-	UpdatedAt          time.Time           `json:"updated_at"`
+	ID                 uint                   `json:"id"`
+	Name               string                 `json:"name"`
+	GroupType          string                 `json:"group_type"`
+	Endpoint           string                 `json:"endpoint"`
+	DisplayName        string                 `json:"display_name"`
+	Description        string                 `json:"description"`
+	Upstreams          datatypes.JSON         `json:"upstreams"`
+	SubGroups          []models.SubGroup      `json:"sub_groups"`
+	ChannelType        string                 `json:"channel_type"`
+	InboundFormat      string                 `json:"inbound_format"`
+	Sort               int                    `json:"sort"`
+	TestModel          string                 `json:"test_model"`
+	ValidationEndpoint string                 `json:"validation_endpoint"`
+	ParamOverrides     datatypes.JSONMap      `json:"param_overrides"`
+	ParamRules         []models.ParamRule     `json:"param_rules"`
+	ModelMapping       datatypes.JSONMap      `json:"model_mapping"`
+	ModelFallbacks     []models.ModelFallback `json:"model_fallbacks"`
+	Config             datatypes.JSONMap      `json:"config"`
+	HeaderRules        []models.HeaderRule    `json:"header_rules"`
+	Plugins            []models.PluginConfig  `json:"plugins"`
+	ProxyKeys          string                 `json:"proxy_keys"`
+	LastValidatedAt    *time.Time             `json:"last_validated_at"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
 }
 
 // newGroupResponse creates a new GroupResponse from a models.Group.
@@ -519,20 +888,60 @@ func (s *Server) newGroupResponse(group *models.Group) *GroupResponse {
 		}
 	}
 
+	var subGroups []models.SubGroup
+	if len(group.SubGroups) > 0 {
+		if err := json.Unmarshal(group.SubGroups, &subGroups); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal sub groups")
+		}
+	}
+
+	paramRules := make([]models.ParamRule, 0)
+	if len(group.ParamRules) > 0 {
+		if err := json.Unmarshal(group.ParamRules, &paramRules); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal param rules")
+		}
+	}
+
+	modelFallbacks := make([]models.ModelFallback, 0)
+	if len(group.ModelFallbacks) > 0 {
+		if err := json.Unmarshal(group.ModelFallbacks, &modelFallbacks); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal model fallbacks")
+		}
+	}
+
+	plugins := make([]models.PluginConfig, 0)
+	if len(group.Plugins) > 0 {
+		if err := json.Unmarshal(group.Plugins, &plugins); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal plugins")
+		}
+	}
+
+	groupType := group.GroupType
+	if groupType == "" {
+		groupType = models.GroupTypeStandard
+	}
+
 	return &GroupResponse{
 		ID:                 group.ID,
 		Name:               group.Name,
+		GroupType:          groupType,
 		Endpoint:           endpoint,
 		DisplayName:        group.DisplayName,
 		Description:        group.Description,
 		Upstreams:          group.Upstreams,
+		SubGroups:          subGroups,
 		ChannelType:        group.ChannelType,
+		InboundFormat:      group.InboundFormat,
 		Sort:               group.Sort,
 		TestModel:          group.TestModel,
 		ValidationEndpoint: group.ValidationEndpoint,
 		ParamOverrides:     group.ParamOverrides,
+		ParamRules:         paramRules,
+		ModelMapping:       group.ModelMapping,
+		ModelFallbacks:     modelFallbacks,
 		Config:             group.Config,
 		HeaderRules:        headerRules,
+		Plugins:            plugins,
 		ProxyKeys:          group.ProxyKeys,
 		LastValidatedAt:    group.LastValidatedAt,
 		CreatedAt:          group.CreatedAt,
@@ -709,6 +1118,8 @@ type GroupStatsResponse struct {
 	HourlyStats RequestStats `json:"hourly_stats"` // 1 hour
 	DailyStats  RequestStats `json:"daily_stats"`  // 24 hours
 	WeeklyStats RequestStats `json:"weekly_stats"` // 7 days
+
+	UpstreamStats *channel.UpstreamStatus `json:"upstream_stats,omitempty"`
 }
 
 // calculateRequestStats is a helper to compute request statistics.
@@ -775,6 +1186,11 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 	}()
 
 	// 3. 1小时请求统计 (查询 request_logs 表)
+	// 聚合分组的请求日志记录在成员分组下，通过 aggregate_group_id 关联
+	groupColumn := "group_id"
+	if group.IsAggregate() {
+		groupColumn = "aggregate_group_id"
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -782,13 +1198,13 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 		now := time.Now()
 		oneHourAgo := now.Add(-1 * time.Hour)
 
-		if err := s.DB.Model(&models.RequestLog{}).Where("group_id = ? AND timestamp BETWEEN ? AND ?", groupID, oneHourAgo, now).Count(&total).Error; err != nil {
+		if err := s.DB.Model(&models.RequestLog{}).Where(groupColumn+" = ? AND timestamp BETWEEN ? AND ?", groupID, oneHourAgo, now).Count(&total).Error; err != nil {
 			mu.Lock()
 			errors = append(errors, fmt.Errorf("failed to get hourly total requests: %w", err))
 			mu.Unlock()
 			return
 		}
-		if err := s.DB.Model(&models.RequestLog{}).Where("group_id = ? AND timestamp BETWEEN ? AND ? AND is_success = ?", groupID, oneHourAgo, now, false).Count(&failed).Error; err != nil {
+		if err := s.DB.Model(&models.RequestLog{}).Where(groupColumn+" = ? AND timestamp BETWEEN ? AND ? AND is_success = ?", groupID, oneHourAgo, now, false).Count(&failed).Error; err != nil {
 			mu.Lock()
 			errors = append(errors, fmt.Errorf("failed to get hourly failed requests: %w", err))
 			mu.Unlock()
@@ -864,6 +1280,18 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 		return
 	}
 
+	// 5. 上游选择策略及各上游的实时状态（聚合分组没有上游）
+	if !group.IsAggregate() {
+		if cachedGroup, err := s.GroupManager.GetGroupByID(groupID); err != nil {
+			logrus.WithError(err).Warnf("Failed to load group %d for upstream stats", groupID)
+		} else if channelHandler, err := s.ChannelFactory.GetChannel(cachedGroup); err != nil {
+			logrus.WithError(err).Warnf("Failed to get channel of group %s for upstream stats", cachedGroup.Name)
+		} else {
+			upstreamStats := channelHandler.UpstreamStatus()
+			resp.UpstreamStats = &upstreamStats
+		}
+	}
+
 	response.Success(c, resp)
 }
 
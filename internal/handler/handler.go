@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"gpt-load/internal/channel"
 	"gpt-load/internal/config"
 	"gpt-load/internal/services"
 	"gpt-load/internal/types"
@@ -28,6 +29,7 @@ type Server struct {
 	KeyImportService              *services.KeyImportService
 	LogService                    *services.LogService
 	CommonHandler                 *CommonHandler
+	ChannelFactory                *channel.Factory
 }
 
 // NewServerParams defines the dependencies for the NewServer constructor.
@@ -44,6 +46,7 @@ type NewServerParams struct {
 	KeyImportService              *services.KeyImportService
 	LogService                    *services.LogService
 	CommonHandler                 *CommonHandler
+	ChannelFactory                *channel.Factory
 }
 
 // NewServer creates a new handler instance with dependencies injected by dig.
@@ -60,6 +63,7 @@ func NewServer(params NewServerParams) *Server {
 		KeyImportService:              params.KeyImportService,
 		LogService:                    params.LogService,
 		CommonHandler:                 params.CommonHandler,
+		ChannelFactory:                params.ChannelFactory,
 	}
 }
 
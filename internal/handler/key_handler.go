@@ -78,7 +78,12 @@ func (s *Server) AddMultipleKeys(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
+		return
+	}
+	if group.IsAggregate() {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Aggregate groups do not hold keys; add keys to their member groups instead"))
 		return
 	}
 
@@ -114,6 +119,10 @@ func (s *Server) AddMultipleKeysAsync(c *gin.Context) {
 	if !ok {
 		return
 	}
+	if group.IsAggregate() {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Aggregate groups do not hold keys; add keys to their member groups instead"))
+		return
+	}
 
 	if err := validateKeysText(req.KeysText); err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
@@ -225,6 +234,85 @@ func (s *Server) RestoreMultipleKeys(c *gin.Context) {
 	response.Success(c, result)
 }
 
+// UpdateKeyLimitsRequest defines the payload for setting per-key request limits.
+type UpdateKeyLimitsRequest struct {
+	GroupID  uint   `json:"group_id" binding:"required"`
+	KeysText string `json:"keys_text" binding:"required"`
+	RpmLimit int    `json:"rpm_limit" binding:"min=0"`
+	RpdLimit int    `json:"rpd_limit" binding:"min=0"`
+}
+
+// UpdateKeyLimits handles setting the RPM and RPD limits of keys from a text block within a specific group.
+func (s *Server) UpdateKeyLimits(c *gin.Context) {
+	var req UpdateKeyLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+		return
+	}
+
+	if err := validateKeysText(req.KeysText); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	result, err := s.KeyService.UpdateKeyLimits(req.GroupID, req.KeysText, req.RpmLimit, req.RpdLimit)
+	if err != nil {
+		if strings.Contains(err.Error(), "batch size exceeds the limit") {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else if err.Error() == "no valid keys found in the input text" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else {
+			response.Error(c, app_errors.ParseDBError(err))
+		}
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// UpdateKeyWeightRequest defines the payload for setting the selection weight of keys.
+type UpdateKeyWeightRequest struct {
+	GroupID  uint   `json:"group_id" binding:"required"`
+	KeysText string `json:"keys_text" binding:"required"`
+	Weight   int    `json:"weight" binding:"required,min=1"`
+}
+
+// UpdateKeyWeight handles setting the selection weight of keys from a text block within a specific group.
+func (s *Server) UpdateKeyWeight(c *gin.Context) {
+	var req UpdateKeyWeightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+		return
+	}
+
+	if err := validateKeysText(req.KeysText); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	result, err := s.KeyService.UpdateKeyWeight(req.GroupID, req.KeysText, req.Weight)
+	if err != nil {
+		if strings.Contains(err.Error(), "batch size exceeds the limit") {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else if err.Error() == "no valid keys found in the input text" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else {
+			response.Error(c, app_errors.ParseDBError(err))
+		}
+		return
+	}
+
+	response.Success(c, result)
+}
+
 // TestMultipleKeys handles a one-off validation test for multiple keys.
 func (s *Server) TestMultipleKeys(c *gin.Context) {
 	var req KeyTextRequest
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // LogResponse defines the structure for log entries in the API response
@@ -32,6 +34,30 @@ func (s *Server) GetLogs(c *gin.Context) {
 	response.Success(c, pagination)
 }
 
+// GetLogDetail returns a single request log together with its captured request and response bodies, if any.
+func (s *Server) GetLogDetail(c *gin.Context) {
+	var logEntry models.RequestLog
+	if err := s.DB.Where("id = ?", c.Param("id")).First(&logEntry).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	var payload models.RequestPayload
+	err := s.DB.Where("log_id = ?", logEntry.ID).First(&payload).Error
+	switch {
+	case err == nil:
+		logEntry.Payload = &payload
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Not captured, or already removed by the payload retention.
+		logEntry.HasPayload = false
+	default:
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	response.Success(c, logEntry)
+}
+
 // ExportLogs handles exporting filtered log keys to a CSV file.
 func (s *Server) ExportLogs(c *gin.Context) {
 	filename := fmt.Sprintf("log_keys_export_%s.csv", time.Now().Format("20060102150405"))
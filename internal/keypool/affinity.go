@@ -0,0 +1,80 @@
+package keypool
+
+import (
+	"errors"
+	"fmt"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// affinityStoreKey returns the store key holding the key ID bound to an affinity key.
+func affinityStoreKey(groupID uint, affinityKey string) string {
+	return fmt.Sprintf("group:%d:affinity:%s", groupID, affinityKey)
+}
+
+// boundKey 返回与 affinityKey 绑定且仍可用的 Key。
+// Key 被删除、拉黑、正在冷却或达到请求数上限时返回 nil，由调用方重新选择。
+func (p *KeyProvider) boundKey(group *models.Group, affinityKey string) (*models.APIKey, error) {
+	value, err := p.store.Get(affinityStoreKey(group.ID, affinityKey))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get key affinity: %w", err)
+	}
+
+	keyIDStr := string(value)
+	keyID, err := strconv.ParseUint(keyIDStr, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	keyDetails, err := p.store.HGetAll(fmt.Sprintf("key:%d", keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key details for key ID %d: %w", keyID, err)
+	}
+	if keyDetails["status"] != models.KeyStatusActive {
+		return nil, nil
+	}
+
+	cooling, err := p.store.HGetAll(fmt.Sprintf("group:%d:cooldown_keys", group.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cooling keys: %w", err)
+	}
+	if _, ok := cooling[keyIDStr]; ok {
+		return nil, nil
+	}
+
+	if rpm, rpd := keyRequestLimits(keyDetails, group); rpm > 0 || rpd > 0 {
+		ok, err := p.reserveKeyQuota(keyIDStr, group, rpm, rpd)
+		if err != nil || !ok {
+			return nil, err
+		}
+	}
+
+	// Refresh the TTL so an ongoing conversation keeps its key.
+	p.bindKeyAffinity(group, affinityKey, keyIDStr)
+	return keyFromDetails(uint(keyID), group.ID, keyDetails), nil
+}
+
+// bindKeyAffinity 将 affinityKey 绑定到指定的 Key，绑定在最后一次使用后保留 KeyAffinityTTLSeconds 秒。
+func (p *KeyProvider) bindKeyAffinity(group *models.Group, affinityKey, keyID string) {
+	ttl := time.Duration(group.EffectiveConfig.KeyAffinityTTLSeconds) * time.Second
+	if err := p.store.Set(affinityStoreKey(group.ID, affinityKey), []byte(keyID), ttl); err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "error": err}).Warn("Failed to bind key affinity")
+	}
+}
+
+// ClearKeyAffinity 解除 affinityKey 的绑定，下一次请求将重新选择 Key。
+func (p *KeyProvider) ClearKeyAffinity(group *models.Group, affinityKey string) {
+	if affinityKey == "" {
+		return
+	}
+	if err := p.store.Delete(affinityStoreKey(group.ID, affinityKey)); err != nil {
+		logrus.WithFields(logrus.Fields{"group": group.Name, "error": err}).Warn("Failed to clear key affinity")
+	}
+}
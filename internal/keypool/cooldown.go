@@ -0,0 +1,83 @@
+package keypool
+
+import (
+	"fmt"
+	"gpt-load/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cooldownSweepInterval limits how often a group's cooling keys are checked for expiry.
+const cooldownSweepInterval = time.Second
+
+// CooldownKey 将 Key 暂时移出轮询列表，冷却结束后自动恢复，不计入失败次数。
+func (p *KeyProvider) CooldownKey(apiKey *models.APIKey, group *models.Group, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+
+	go func() {
+		until := time.Now().Add(duration)
+		cooldownKey := fmt.Sprintf("group:%d:cooldown_keys", group.ID)
+		activeKeysListKey := fmt.Sprintf("group:%d:active_keys", group.ID)
+
+		if err := p.store.HSet(cooldownKey, map[string]any{fmt.Sprint(apiKey.ID): until.Unix()}); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to record key cooldown")
+			return
+		}
+		if err := p.store.LRem(activeKeysListKey, 0, apiKey.ID); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to remove cooling key from active list")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "group": group.Name, "until": until.Format(time.RFC3339)}).Debug("Key is rate limited and cooling down.")
+	}()
+}
+
+// restoreCooledDownKeys 将冷却结束的 Key 放回分组的轮询列表。
+func (p *KeyProvider) restoreCooledDownKeys(groupID uint) {
+	now := time.Now()
+	if last, ok := p.cooldownSweeps.Load(groupID); ok && now.Sub(last.(time.Time)) < cooldownSweepInterval {
+		return
+	}
+	p.cooldownSweeps.Store(groupID, now)
+
+	cooldownKey := fmt.Sprintf("group:%d:cooldown_keys", groupID)
+	entries, err := p.store.HGetAll(cooldownKey)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to read cooling keys")
+		return
+	}
+
+	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
+	for keyIDStr, untilStr := range entries {
+		until, _ := strconv.ParseInt(untilStr, 10, 64)
+		if until > now.Unix() {
+			continue
+		}
+
+		// Only the instance that removes the entry restores the key, so it is never pushed twice.
+		deleted, err := p.store.HDel(cooldownKey, keyIDStr)
+		if err != nil || deleted == 0 {
+			continue
+		}
+
+		// The key may have been deleted or blacklisted while cooling down.
+		keyDetails, err := p.store.HGetAll(fmt.Sprintf("key:%s", keyIDStr))
+		if err != nil || keyDetails["status"] != models.KeyStatusActive {
+			continue
+		}
+
+		if err := p.store.LRem(activeKeysListKey, 0, keyIDStr); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": keyIDStr, "error": err}).Error("Failed to LRem key before restoring it from cooldown")
+			continue
+		}
+		if err := p.store.LPush(activeKeysListKey, keyIDStr); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": keyIDStr, "error": err}).Error("Failed to restore key from cooldown")
+			continue
+		}
+		logrus.WithField("keyID", keyIDStr).Debug("Key cooldown has ended, restored to active pool.")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -20,6 +21,7 @@ type KeyProvider struct {
 	db              *gorm.DB
 	store           store.Store
 	settingsManager *config.SystemSettingsManager
+	cooldownSweeps  sync.Map // groupID -> time.Time of the last cooldown sweep
 }
 
 // NewProvider 创建一个新的 KeyProvider 实例。
@@ -31,45 +33,88 @@ func NewProvider(db *gorm.DB, store store.Store, settingsManager *config.SystemS
 	}
 }
 
-// SelectKey 为指定的分组原子性地选择并轮换一个可用的 APIKey。
-func (p *KeyProvider) SelectKey(groupID uint) (*models.APIKey, error) {
+// SelectKey 按分组配置的选择策略为指定的分组选择一个可用的 APIKey，跳过已达到请求数上限的 Key。
+// affinityKey 非空时优先返回与之绑定的 Key，并将最终选中的 Key 与之绑定。
+func (p *KeyProvider) SelectKey(group *models.Group, affinityKey string) (*models.APIKey, error) {
+	groupID := group.ID
 	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
 
-	// 1. Atomically rotate the key ID from the list
-	keyIDStr, err := p.store.Rotate(activeKeysListKey)
-	if err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			return nil, app_errors.ErrNoActiveKeys
+	// 0. Put keys whose rate limit cooldown has ended back into rotation
+	p.restoreCooledDownKeys(groupID)
+
+	// 1. Reuse the key bound to the conversation while it is still usable
+	if affinityKey != "" {
+		apiKey, err := p.boundKey(group, affinityKey)
+		if err != nil {
+			return nil, err
+		}
+		if apiKey != nil {
+			return apiKey, nil
 		}
-		return nil, fmt.Errorf("failed to rotate key from store: %w", err)
 	}
 
-	keyID, err := strconv.ParseUint(keyIDStr, 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse key ID '%s': %w", keyIDStr, err)
-	}
+	// Every key at its request limits is skipped, so the selector runs out of candidates
+	// once each active key has been tried.
+	selector := p.selectorFor(group)
+	skipped := make(map[string]struct{})
+	for {
+		// 2. Pick the next key ID with the group's selection strategy
+		keyIDStr, err := selector.next(activeKeysListKey, skipped)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil, app_errors.ErrNoActiveKeys
+			}
+			if errors.Is(err, errKeysExhausted) {
+				return nil, fmt.Errorf("%w: all keys have reached their request limits", app_errors.ErrNoActiveKeys)
+			}
+			return nil, fmt.Errorf("failed to select key from store: %w", err)
+		}
 
-	// 2. Get key details from HASH
-	keyHashKey := fmt.Sprintf("key:%d", keyID)
-	keyDetails, err := p.store.HGetAll(keyHashKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get key details for key ID %d: %w", keyID, err)
+		keyID, err := strconv.ParseUint(keyIDStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key ID '%s': %w", keyIDStr, err)
+		}
+
+		// 3. Get key details from HASH
+		keyHashKey := fmt.Sprintf("key:%d", keyID)
+		keyDetails, err := p.store.HGetAll(keyHashKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key details for key ID %d: %w", keyID, err)
+		}
+
+		// 4. Skip keys that have reached their request limits
+		if rpm, rpd := keyRequestLimits(keyDetails, group); rpm > 0 || rpd > 0 {
+			ok, err := p.reserveKeyQuota(keyIDStr, group, rpm, rpd)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				skipped[keyIDStr] = struct{}{}
+				continue
+			}
+		}
+
+		if affinityKey != "" {
+			p.bindKeyAffinity(group, affinityKey, keyIDStr)
+		}
+
+		return keyFromDetails(uint(keyID), groupID, keyDetails), nil
 	}
+}
 
-	// 3. Manually unmarshal the map into an APIKey struct
+// keyFromDetails manually unmarshals a key HASH into an APIKey struct.
+func keyFromDetails(keyID, groupID uint, keyDetails map[string]string) *models.APIKey {
 	failureCount, _ := strconv.ParseInt(keyDetails["failure_count"], 10, 64)
 	createdAt, _ := strconv.ParseInt(keyDetails["created_at"], 10, 64)
 
-	apiKey := &models.APIKey{
-		ID:           uint(keyID),
+	return &models.APIKey{
+		ID:           keyID,
 		KeyValue:     keyDetails["key_string"],
 		Status:       keyDetails["status"],
 		FailureCount: failureCount,
 		GroupID:      groupID,
 		CreatedAt:    time.Unix(createdAt, 0),
 	}
-
-	return apiKey, nil
 }
 
 // UpdateStatus 异步地提交一个 Key 状态更新任务。
@@ -509,7 +554,7 @@ func (p *KeyProvider) RemoveKeysFromStore(groupID uint, keyIDs []uint) error {
 	// 第二步：批量删除所有相关的key hash
 	for _, keyID := range keyIDs {
 		keyHashKey := fmt.Sprintf("key:%d", keyID)
-		if err := p.store.Delete(keyHashKey); err != nil {
+		if err := p.store.Del(keyHashKey, fmt.Sprintf("key:%d:quota", keyID), fmt.Sprintf("key:%d:health", keyID)); err != nil {
 			logrus.WithFields(logrus.Fields{
 				"keyID": keyID,
 				"error": err,
@@ -555,12 +600,48 @@ func (p *KeyProvider) removeKeyFromStore(keyID, groupID uint) error {
 	}
 
 	keyHashKey := fmt.Sprintf("key:%d", keyID)
-	if err := p.store.Delete(keyHashKey); err != nil {
+	if err := p.store.Del(keyHashKey, fmt.Sprintf("key:%d:quota", keyID), fmt.Sprintf("key:%d:health", keyID)); err != nil {
 		return fmt.Errorf("failed to delete key HASH for key %d: %w", keyID, err)
 	}
 	return nil
 }
 
+// updateKeyFields updates columns of the given keys in the DB and mirrors them into the key hashes.
+func (p *KeyProvider) updateKeyFields(groupID uint, keyValues []string, updates map[string]any) (int64, error) {
+	if len(keyValues) == 0 {
+		return 0, nil
+	}
+
+	var keys []models.APIKey
+	var updatedCount int64
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND key_value IN ?", groupID, keyValues).Find(&keys).Error; err != nil {
+			return err
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		result := tx.Model(&models.APIKey{}).Where("id IN ?", pluckIDs(keys)).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		updatedCount = result.RowsAffected
+
+		for _, key := range keys {
+			if err := p.store.HSet(fmt.Sprintf("key:%d", key.ID), updates); err != nil {
+				logrus.WithFields(logrus.Fields{"keyID": key.ID, "error": err}).Error("Failed to update key fields in store")
+				return err
+			}
+		}
+		return nil
+	})
+
+	return updatedCount, err
+}
+
 // apiKeyToMap converts an APIKey model to a map for HSET.
 func (p *KeyProvider) apiKeyToMap(key *models.APIKey) map[string]any {
 	return map[string]any{
@@ -568,6 +649,9 @@ func (p *KeyProvider) apiKeyToMap(key *models.APIKey) map[string]any {
 		"key_string":    key.KeyValue,
 		"status":        key.Status,
 		"failure_count": key.FailureCount,
+		"rpm_limit":     key.RpmLimit,
+		"rpd_limit":     key.RpdLimit,
+		"weight":        key.Weight,
 		"group_id":      key.GroupID,
 		"created_at":    key.CreatedAt.Unix(),
 	}
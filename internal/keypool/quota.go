@@ -0,0 +1,129 @@
+package keypool
+
+import (
+	"fmt"
+	"gpt-load/internal/models"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// quotaLocations caches loaded time zones by name.
+var quotaLocations sync.Map
+
+// quotaLocation returns the time zone used for daily quota resets, falling back to UTC.
+func quotaLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	if loc, ok := quotaLocations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		logrus.Warnf("Invalid quota reset time zone '%s', using UTC: %v", name, err)
+		loc = time.UTC
+	}
+	quotaLocations.Store(name, loc)
+	return loc
+}
+
+// keyRequestLimits returns the effective RPM and RPD limits of a key; a per-key limit overrides the group's.
+func keyRequestLimits(keyDetails map[string]string, group *models.Group) (rpm, rpd int) {
+	rpm = group.EffectiveConfig.KeyRpmLimit
+	rpd = group.EffectiveConfig.KeyRpdLimit
+	if keyRpm, _ := strconv.Atoi(keyDetails["rpm_limit"]); keyRpm > 0 {
+		rpm = keyRpm
+	}
+	if keyRpd, _ := strconv.Atoi(keyDetails["rpd_limit"]); keyRpd > 0 {
+		rpd = keyRpd
+	}
+	return rpm, rpd
+}
+
+// reserveKeyQuota counts a request against the key's minute and day windows.
+// It returns false and leaves the counters unchanged if either limit has been reached.
+func (p *KeyProvider) reserveKeyQuota(keyID string, group *models.Group, rpm, rpd int) (bool, error) {
+	return p.reserveKeyQuotaAt(time.Now(), keyID, group, rpm, rpd)
+}
+
+func (p *KeyProvider) reserveKeyQuotaAt(now time.Time, keyID string, group *models.Group, rpm, rpd int) (bool, error) {
+	loc := quotaLocation(group.EffectiveConfig.QuotaResetTimezone)
+	quotaKey := fmt.Sprintf("key:%s:quota", keyID)
+	minuteField := "m:" + now.UTC().Format("200601021504")
+	dayField := "d:" + now.In(loc).Format("20060102")
+
+	var reserved []string
+	release := func() {
+		for _, field := range reserved {
+			if _, err := p.store.HIncrBy(quotaKey, field, -1); err != nil {
+				logrus.WithFields(logrus.Fields{"keyID": keyID, "error": err}).Error("Failed to release key quota")
+			}
+		}
+	}
+
+	for _, window := range []struct {
+		field string
+		limit int
+	}{{minuteField, rpm}, {dayField, rpd}} {
+		if window.limit <= 0 {
+			continue
+		}
+		count, err := p.store.HIncrBy(quotaKey, window.field, 1)
+		if err != nil {
+			release()
+			return false, fmt.Errorf("failed to count request for key %s: %w", keyID, err)
+		}
+		reserved = append(reserved, window.field)
+		if count > int64(window.limit) {
+			release()
+			return false, nil
+		}
+		if count == 1 {
+			p.pruneQuotaWindows(quotaKey, minuteField, dayField)
+			// The counters are useless once the day window is over, e.g. after the key has been deleted.
+			if err := p.store.Expire(quotaKey, quotaWindowTTL(now, loc)); err != nil {
+				logrus.WithFields(logrus.Fields{"quotaKey": quotaKey, "error": err}).Warn("Failed to set quota expiry")
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// quotaWindowTTL returns how long the counters started at now are needed: until the day window ends,
+// plus a minute so that the last minute window of the day is not cut short.
+func quotaWindowTTL(now time.Time, loc *time.Location) time.Duration {
+	local := now.In(loc)
+	dayEnd := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+	return dayEnd.Sub(now) + time.Minute
+}
+
+// pruneQuotaWindows removes the counters of past windows once a new window has started.
+func (p *KeyProvider) pruneQuotaWindows(quotaKey, minuteField, dayField string) {
+	counters, err := p.store.HGetAll(quotaKey)
+	if err != nil {
+		return
+	}
+	var stale []string
+	for field := range counters {
+		if field != minuteField && field != dayField {
+			stale = append(stale, field)
+		}
+	}
+	if len(stale) > 0 {
+		if _, err := p.store.HDel(quotaKey, stale...); err != nil {
+			logrus.WithFields(logrus.Fields{"quotaKey": quotaKey, "error": err}).Warn("Failed to prune stale quota windows")
+		}
+	}
+}
+
+// UpdateKeyLimits 设置指定 Key 的每分钟和每日请求数上限，0 表示使用分组配置。
+func (p *KeyProvider) UpdateKeyLimits(groupID uint, keyValues []string, rpmLimit, rpdLimit int) (int64, error) {
+	return p.updateKeyFields(groupID, keyValues, map[string]any{
+		"rpm_limit": rpmLimit,
+		"rpd_limit": rpdLimit,
+	})
+}
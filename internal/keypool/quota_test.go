@@ -0,0 +1,140 @@
+package keypool
+
+import (
+	"testing"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+)
+
+func TestReserveKeyQuotaWindows(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	at := func(value string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04:05", value, la)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	type reservation struct {
+		at   string
+		want bool
+	}
+	tests := []struct {
+		name         string
+		rpm, rpd     int
+		reservations []reservation
+	}{
+		{
+			name: "minute window rolls over",
+			rpm:  1,
+			reservations: []reservation{
+				{"2025-03-10 10:00:10", true},
+				{"2025-03-10 10:00:50", false},
+				{"2025-03-10 10:01:05", true},
+				{"2025-03-10 10:01:59", false},
+			},
+		},
+		{
+			name: "day window resets at midnight of the quota time zone",
+			rpd:  2,
+			reservations: []reservation{
+				{"2025-03-10 23:58:00", true},
+				{"2025-03-10 23:59:00", true},
+				{"2025-03-10 23:59:30", false},
+				{"2025-03-11 00:00:30", true},
+				{"2025-03-11 00:01:00", true},
+				{"2025-03-11 00:02:00", false},
+			},
+		},
+		{
+			name: "rejected request does not use the day quota",
+			rpm:  1,
+			rpd:  2,
+			reservations: []reservation{
+				{"2025-03-10 09:00:00", true},
+				{"2025-03-10 09:00:30", false},
+				{"2025-03-10 09:01:00", true},
+				{"2025-03-10 09:02:00", false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := store.NewMemoryStore()
+			defer memStore.Close()
+			p := &KeyProvider{store: memStore}
+			group := &models.Group{EffectiveConfig: types.SystemSettings{QuotaResetTimezone: "America/Los_Angeles"}}
+
+			for _, r := range tt.reservations {
+				ok, err := p.reserveKeyQuotaAt(at(r.at), "1", group, tt.rpm, tt.rpd)
+				if err != nil {
+					t.Fatalf("reserveKeyQuotaAt(%s) error = %v", r.at, err)
+				}
+				if ok != r.want {
+					t.Fatalf("reserveKeyQuotaAt(%s) = %v, want %v", r.at, ok, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReserveKeyQuotaPrunesPastWindows(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	defer memStore.Close()
+	p := &KeyProvider{store: memStore}
+	group := &models.Group{EffectiveConfig: types.SystemSettings{QuotaResetTimezone: "UTC"}}
+
+	day1 := time.Date(2025, 3, 10, 23, 59, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Minute)
+	for _, now := range []time.Time{day1, day2} {
+		if _, err := p.reserveKeyQuotaAt(now, "1", group, 10, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counters, err := memStore.HGetAll("key:1:quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"m:202503110001": "1", "d:20250311": "1"}
+	if len(counters) != len(want) {
+		t.Fatalf("counters = %v, want %v", counters, want)
+	}
+	for field, value := range want {
+		if counters[field] != value {
+			t.Fatalf("counters = %v, want %v", counters, want)
+		}
+	}
+}
+
+func TestQuotaWindowTTL(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	tests := []struct {
+		name string
+		now  time.Time
+		loc  *time.Location
+		want time.Duration
+	}{
+		{"UTC", time.Date(2025, 3, 10, 23, 0, 0, 0, time.UTC), time.UTC, time.Hour + time.Minute},
+		{"start of day", time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), time.UTC, 24*time.Hour + time.Minute},
+		{"other time zone", time.Date(2025, 3, 10, 22, 30, 0, 0, la), la, 90*time.Minute + time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quotaWindowTTL(tt.now, tt.loc); got != tt.want {
+				t.Fatalf("quotaWindowTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package keypool
+
+import (
+	"errors"
+	"fmt"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// resourceAffinityTTL bounds how long the owner of a stateful object is remembered.
+// Objects are usually deleted explicitly, which removes the mapping right away.
+const resourceAffinityTTL = 30 * 24 * time.Hour
+
+func resourceStoreKey(resourceID string) string {
+	return "resource_affinity:" + resourceID
+}
+
+// BindResource 记录创建对象（文件、批处理、助手等）的 Key，后续引用该对象的请求将使用同一个 Key。
+func (p *KeyProvider) BindResource(resourceID string, apiKey *models.APIKey) {
+	value := fmt.Sprintf("%d:%d", apiKey.GroupID, apiKey.ID)
+	if err := p.store.Set(resourceStoreKey(resourceID), []byte(value), resourceAffinityTTL); err != nil {
+		logrus.WithFields(logrus.Fields{"resourceID": resourceID, "error": err}).Warn("Failed to record resource owner")
+	}
+}
+
+// UnbindResource 在对象被删除后移除其所属 Key 的记录。
+func (p *KeyProvider) UnbindResource(resourceID string) {
+	if err := p.store.Delete(resourceStoreKey(resourceID)); err != nil {
+		logrus.WithFields(logrus.Fields{"resourceID": resourceID, "error": err}).Warn("Failed to remove resource owner")
+	}
+}
+
+// ResourceOwner 返回创建了其中任一对象的分组 ID 和 Key ID，未记录时 ok 为 false。
+func (p *KeyProvider) ResourceOwner(resourceIDs []string) (groupID, keyID uint, ok bool) {
+	for _, resourceID := range resourceIDs {
+		value, err := p.store.Get(resourceStoreKey(resourceID))
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				logrus.WithFields(logrus.Fields{"resourceID": resourceID, "error": err}).Warn("Failed to read resource owner")
+			}
+			continue
+		}
+
+		groupPart, keyPart, found := strings.Cut(string(value), ":")
+		if !found {
+			continue
+		}
+		group, err1 := strconv.ParseUint(groupPart, 10, 64)
+		key, err2 := strconv.ParseUint(keyPart, 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		return uint(group), uint(key), true
+	}
+	return 0, 0, false
+}
+
+// SelectResourceKey 返回创建了所引用对象的 Key。对象只存在于创建它的 Key 下，因此不检查 Key 状态。
+// 没有记录、记录属于其他分组或 Key 已被删除时返回 nil。
+func (p *KeyProvider) SelectResourceKey(group *models.Group, resourceIDs []string) (*models.APIKey, error) {
+	groupID, keyID, ok := p.ResourceOwner(resourceIDs)
+	if !ok || groupID != group.ID {
+		return nil, nil
+	}
+
+	keyDetails, err := p.store.HGetAll(fmt.Sprintf("key:%d", keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key details for key ID %d: %w", keyID, err)
+	}
+	if keyDetails["key_string"] == "" {
+		return nil, nil
+	}
+	return keyFromDetails(keyID, group.ID, keyDetails), nil
+}
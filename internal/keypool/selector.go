@@ -0,0 +1,329 @@
+package keypool
+
+import (
+	"errors"
+	"fmt"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Key selection strategies, configured per group with the key_selection_strategy setting.
+const (
+	KeySelectionRoundRobin    = "round_robin"
+	KeySelectionRandom        = "random"
+	KeySelectionLRU           = "lru"
+	KeySelectionLeastFailures = "least_failures"
+	KeySelectionWeighted      = "weighted"
+	KeySelectionHealthScore   = "health_score"
+)
+
+const (
+	// maxSelectionCandidates bounds how many keys a scoring strategy inspects per request.
+	// Larger groups are sampled, which keeps the store round trips constant.
+	maxSelectionCandidates = 32
+
+	// healthScoreAlpha is the weight of the newest outcome in a key's success rate and latency averages.
+	healthScoreAlpha = 0.2
+)
+
+// errKeysExhausted is returned by a keySelector when every active key has been skipped.
+var errKeysExhausted = errors.New("all active keys have been tried")
+
+// keySelector picks the next key to use from a group's active keys.
+// Implementations only rely on the store.Store interface, so they work with both the memory and the Redis store.
+// A selector is created for each SelectKey call, so it may keep what it loaded for the keys it skips to.
+type keySelector interface {
+	// next returns the ID of the next key to try, never returning a key in skipped.
+	// It returns store.ErrNotFound if the group has no active keys and errKeysExhausted if all of them are skipped.
+	next(activeKeysListKey string, skipped map[string]struct{}) (string, error)
+}
+
+// selectorFor returns the key selector configured for the group.
+func (p *KeyProvider) selectorFor(group *models.Group) keySelector {
+	switch group.EffectiveConfig.KeySelectionStrategy {
+	case KeySelectionRandom:
+		return &randomSelector{keys: candidateList{store: p.store}}
+	case KeySelectionLRU:
+		return newScoredSelector(p.store, pickMinimum(lruScore), false, true)
+	case KeySelectionLeastFailures:
+		return newScoredSelector(p.store, pickMinimum(failureScore), false, false)
+	case KeySelectionWeighted:
+		return newScoredSelector(p.store, pickWeighted(keyWeight), false, false)
+	case KeySelectionHealthScore:
+		return newScoredSelector(p.store, pickWeighted(healthScore), true, false)
+	default:
+		return &roundRobinSelector{store: p.store}
+	}
+}
+
+// roundRobinSelector rotates the active key list, giving every key a turn.
+type roundRobinSelector struct {
+	store store.Store
+}
+
+func (s *roundRobinSelector) next(activeKeysListKey string, skipped map[string]struct{}) (string, error) {
+	keyID, err := s.store.Rotate(activeKeysListKey)
+	if err != nil {
+		return "", err
+	}
+	// The list has come full circle once a skipped key comes up again.
+	if _, ok := skipped[keyID]; ok {
+		return "", errKeysExhausted
+	}
+	return keyID, nil
+}
+
+// randomSelector picks a key uniformly at random.
+type randomSelector struct {
+	keys candidateList
+}
+
+func (s *randomSelector) next(activeKeysListKey string, skipped map[string]struct{}) (string, error) {
+	keyIDs, err := s.keys.candidates(activeKeysListKey, skipped)
+	if err != nil {
+		return "", err
+	}
+	return keyIDs[rand.Intn(len(keyIDs))], nil
+}
+
+// keyCandidate is an active key with the details a scoring strategy needs.
+type keyCandidate struct {
+	id      string
+	details map[string]string
+	health  map[string]string
+}
+
+// scoredSelector loads the details of a sample of keys and lets a pick function choose among them.
+// Details are loaded once per key, so skipping keys at their request limits costs one lookup per key.
+type scoredSelector struct {
+	store      store.Store
+	keys       candidateList
+	loaded     map[string]keyCandidate
+	pick       func([]keyCandidate) int
+	withHealth bool // load the key:<id>:health hash as well
+	touch      bool // record last_used_at on the selected key
+}
+
+func newScoredSelector(s store.Store, pick func([]keyCandidate) int, withHealth, touch bool) *scoredSelector {
+	return &scoredSelector{
+		store:      s,
+		keys:       candidateList{store: s},
+		loaded:     make(map[string]keyCandidate),
+		pick:       pick,
+		withHealth: withHealth,
+		touch:      touch,
+	}
+}
+
+func (s *scoredSelector) next(activeKeysListKey string, skipped map[string]struct{}) (string, error) {
+	keyIDs, err := s.keys.candidates(activeKeysListKey, skipped)
+	if err != nil {
+		return "", err
+	}
+	if len(keyIDs) > maxSelectionCandidates {
+		rand.Shuffle(len(keyIDs), func(i, j int) { keyIDs[i], keyIDs[j] = keyIDs[j], keyIDs[i] })
+		keyIDs = keyIDs[:maxSelectionCandidates]
+	}
+
+	candidates := make([]keyCandidate, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		candidate, err := s.candidate(keyID)
+		if err != nil {
+			return "", err
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	selected := candidates[s.pick(candidates)].id
+	if s.touch {
+		if err := s.store.HSet(fmt.Sprintf("key:%s", selected), map[string]any{"last_used_at": time.Now().UnixNano()}); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": selected, "error": err}).Warn("Failed to record key last used time")
+		}
+	}
+	return selected, nil
+}
+
+// candidate returns the details of a key, loading them on first use.
+func (s *scoredSelector) candidate(keyID string) (keyCandidate, error) {
+	if candidate, ok := s.loaded[keyID]; ok {
+		return candidate, nil
+	}
+	details, err := s.store.HGetAll(fmt.Sprintf("key:%s", keyID))
+	if err != nil {
+		return keyCandidate{}, fmt.Errorf("failed to get key details for key ID %s: %w", keyID, err)
+	}
+	candidate := keyCandidate{id: keyID, details: details}
+	if s.withHealth {
+		if candidate.health, err = s.store.HGetAll(fmt.Sprintf("key:%s:health", keyID)); err != nil {
+			return keyCandidate{}, fmt.Errorf("failed to get key health for key ID %s: %w", keyID, err)
+		}
+	}
+	s.loaded[keyID] = candidate
+	return candidate, nil
+}
+
+// candidateList lists a group's active keys once per selection; later calls only leave out the skipped keys.
+type candidateList struct {
+	store  store.Store
+	keyIDs []string
+	listed bool
+}
+
+// candidates returns the active keys that have not been skipped yet.
+func (l *candidateList) candidates(activeKeysListKey string, skipped map[string]struct{}) ([]string, error) {
+	if !l.listed {
+		keyIDs, err := l.store.LRange(activeKeysListKey, 0, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list active keys: %w", err)
+		}
+		l.keyIDs, l.listed = keyIDs, true
+	}
+	if len(l.keyIDs) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	candidates := make([]string, 0, len(l.keyIDs))
+	for _, keyID := range l.keyIDs {
+		if _, ok := skipped[keyID]; !ok {
+			candidates = append(candidates, keyID)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errKeysExhausted
+	}
+	return candidates, nil
+}
+
+// pickMinimum returns a pick function choosing the candidate with the lowest score, breaking ties at random.
+func pickMinimum(score func(keyCandidate) float64) func([]keyCandidate) int {
+	return func(candidates []keyCandidate) int {
+		best, ties := 0, 0
+		bestScore := math.Inf(1)
+		for i, candidate := range candidates {
+			value := score(candidate)
+			switch {
+			case value < bestScore:
+				best, bestScore, ties = i, value, 1
+			case value == bestScore:
+				ties++
+				if rand.Intn(ties) == 0 {
+					best = i
+				}
+			}
+		}
+		return best
+	}
+}
+
+// pickWeighted returns a pick function choosing a candidate at random in proportion to its weight.
+func pickWeighted(weight func(keyCandidate) float64) func([]keyCandidate) int {
+	return func(candidates []keyCandidate) int {
+		weights := make([]float64, len(candidates))
+		total := 0.0
+		for i, candidate := range candidates {
+			weights[i] = weight(candidate)
+			total += weights[i]
+		}
+		if total <= 0 {
+			return rand.Intn(len(candidates))
+		}
+
+		target := rand.Float64() * total
+		for i, w := range weights {
+			target -= w
+			if target < 0 {
+				return i
+			}
+		}
+		return len(candidates) - 1
+	}
+}
+
+// lruScore orders keys by the time they were last selected; keys never selected come first.
+func lruScore(candidate keyCandidate) float64 {
+	lastUsed, _ := strconv.ParseFloat(candidate.details["last_used_at"], 64)
+	return lastUsed
+}
+
+// failureScore orders keys by their consecutive failure count.
+func failureScore(candidate keyCandidate) float64 {
+	failures, _ := strconv.ParseFloat(candidate.details["failure_count"], 64)
+	return failures
+}
+
+// keyWeight returns the configured weight of a key, defaulting to 1.
+func keyWeight(candidate keyCandidate) float64 {
+	weight, _ := strconv.ParseFloat(candidate.details["weight"], 64)
+	if weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+// healthScore favours keys with a high recent success rate and a low latency.
+// Keys without recorded outcomes get the best score so they are tried early.
+func healthScore(candidate keyCandidate) float64 {
+	successRate := 1.0
+	if value, err := strconv.ParseFloat(candidate.health["success_rate"], 64); err == nil {
+		successRate = value
+	}
+	latencyMs, _ := strconv.ParseFloat(candidate.health["latency_ms"], 64)
+
+	// Keep a small chance for failing keys so they can recover their score.
+	return math.Max(successRate, 0.01) * 1000 / (1000 + latencyMs)
+}
+
+// RecordKeyOutcome 记录 Key 的请求结果和延迟，仅在分组使用 health_score 策略时生效。
+func (p *KeyProvider) RecordKeyOutcome(apiKey *models.APIKey, group *models.Group, isSuccess bool, latency time.Duration) {
+	if group.EffectiveConfig.KeySelectionStrategy != KeySelectionHealthScore {
+		return
+	}
+
+	go func() {
+		healthKey := fmt.Sprintf("key:%d:health", apiKey.ID)
+		health, err := p.store.HGetAll(healthKey)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Warn("Failed to read key health")
+			return
+		}
+
+		outcome := 0.0
+		if isSuccess {
+			outcome = 1
+		}
+		latencyMs := float64(latency.Milliseconds())
+
+		successRate := outcome
+		if value, err := strconv.ParseFloat(health["success_rate"], 64); err == nil {
+			successRate = healthScoreAlpha*outcome + (1-healthScoreAlpha)*value
+		}
+		// Requests that failed before a response arrived carry no latency sample.
+		latencyAvg, err := strconv.ParseFloat(health["latency_ms"], 64)
+		switch {
+		case latency <= 0:
+		case err != nil:
+			latencyAvg = latencyMs
+		default:
+			latencyAvg = healthScoreAlpha*latencyMs + (1-healthScoreAlpha)*latencyAvg
+		}
+
+		// Concurrent updates may overwrite each other; the score is an approximation either way.
+		if err := p.store.HSet(healthKey, map[string]any{
+			"success_rate": strconv.FormatFloat(successRate, 'f', 4, 64),
+			"latency_ms":   strconv.FormatFloat(latencyAvg, 'f', 1, 64),
+		}); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Warn("Failed to update key health")
+		}
+	}()
+}
+
+// UpdateKeyWeight 设置指定 Key 在 weighted 策略下的权重。
+func (p *KeyProvider) UpdateKeyWeight(groupID uint, keyValues []string, weight int) (int64, error) {
+	return p.updateKeyFields(groupID, keyValues, map[string]any{"weight": weight})
+}
@@ -7,15 +7,47 @@ import (
 	"strings"
 	"time"
 
+	"gpt-load/internal/channel"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/response"
 	"gpt-load/internal/services"
 	"gpt-load/internal/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+// maxRequestIDLength bounds an incoming X-Request-ID; longer or malformed values are replaced.
+const maxRequestIDLength = 128
+
+// RequestID accepts the client's X-Request-ID or generates one, and returns it in the response.
+// The ID is stored in the context as "requestID" for logging and is forwarded upstream by the proxy.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Set("requestID", requestID)
+		c.Header("X-Request-ID", requestID)
+		c.Next()
+	}
+}
+
+// isValidRequestID only accepts IDs that are safe to store and to echo in headers and logs.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
 // Logger creates a high-performance logging middleware
 func Logger(config types.LogConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -54,22 +86,28 @@ func Logger(config types.LogConfig) gin.HandlerFunc {
 			retryInfo = fmt.Sprintf(" - Retry[%d]", retryCount)
 		}
 
+		// Attach the request ID as a log field (if exists)
+		entry := logrus.NewEntry(logrus.StandardLogger())
+		if requestID := c.GetString("requestID"); requestID != "" {
+			entry = entry.WithField("request_id", requestID)
+		}
+
 		// Filter health check and other monitoring endpoint logs to reduce noise
 		if isMonitoringEndpoint(path) {
 			// Only log errors for monitoring endpoints
 			if statusCode >= 400 {
-				logrus.Warnf("%s %s - %d - %v", method, fullPath, statusCode, latency)
+				entry.Warnf("%s %s - %d - %v", method, fullPath, statusCode, latency)
 			}
 			return
 		}
 
 		// Choose log level based on status code
 		if statusCode >= 500 {
-			logrus.Errorf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			entry.Errorf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
 		} else if statusCode >= 400 {
-			logrus.Warnf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			entry.Warnf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
 		} else {
-			logrus.Infof("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			entry.Infof("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
 		}
 	}
 }
@@ -140,19 +178,21 @@ func Auth(authConfig types.AuthConfig) gin.HandlerFunc {
 }
 
 // ProxyAuth
+// Every auth failure is the same 401, in the API format the request itself is written in, so that SDKs report it
+// as an auth error while callers without a valid key cannot tell which group names exist.
 func ProxyAuth(gm *services.GroupManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check key
 		key := extractAuthKey(c)
 		if key == "" {
-			response.Error(c, app_errors.ErrUnauthorized)
+			channel.WriteError(c, channel.RequestFormat(c.Request), app_errors.ErrUnauthorized)
 			c.Abort()
 			return
 		}
 
 		group, err := gm.GetGroupByName(c.Param("group_name"))
 		if err != nil {
-			response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, "Failed to retrieve proxy group"))
+			channel.WriteError(c, channel.RequestFormat(c.Request), app_errors.ErrUnauthorized)
 			c.Abort()
 			return
 		}
@@ -162,11 +202,13 @@ func ProxyAuth(gm *services.GroupManager) gin.HandlerFunc {
 		_, existsInGroup := group.ProxyKeysMap[key]
 
 		if existsInEffective || existsInGroup {
+			// The proxy applies per-key rules such as model access.
+			c.Set("proxyKey", key)
 			c.Next()
 			return
 		}
 
-		response.Error(c, app_errors.ErrUnauthorized)
+		channel.WriteError(c, channel.RequestFormat(c.Request), app_errors.ErrUnauthorized)
 		c.Abort()
 	}
 }
@@ -257,6 +299,13 @@ func extractAuthKey(c *gin.Context) string {
 		return key
 	}
 
+	// Browsers cannot set headers on a WebSocket handshake, so the OpenAI Realtime API takes the key as a subprotocol.
+	for _, protocol := range strings.Split(c.GetHeader("Sec-WebSocket-Protocol"), ",") {
+		if key, ok := strings.CutPrefix(strings.TrimSpace(protocol), "openai-insecure-api-key."); ok && key != "" {
+			return key
+		}
+	}
+
 	return ""
 }
 
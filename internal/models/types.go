@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"gpt-load/internal/types"
 	"time"
 
@@ -13,6 +14,12 @@ const (
 	KeyStatusInvalid = "invalid"
 )
 
+// 分组类型
+const (
+	GroupTypeStandard  = "standard"
+	GroupTypeAggregate = "aggregate"
+)
+
 // SystemSetting 对应 system_settings 表
 type SystemSetting struct {
 	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -25,18 +32,58 @@ type SystemSetting struct {
 
 // GroupConfig 存储特定于分组的配置
 type GroupConfig struct {
-	RequestTimeout               *int    `json:"request_timeout,omitempty"`
-	IdleConnTimeout              *int    `json:"idle_conn_timeout,omitempty"`
-	ConnectTimeout               *int    `json:"connect_timeout,omitempty"`
-	MaxIdleConns                 *int    `json:"max_idle_conns,omitempty"`
-	MaxIdleConnsPerHost          *int    `json:"max_idle_conns_per_host,omitempty"`
-	ResponseHeaderTimeout        *int    `json:"response_header_timeout,omitempty"`
-	ProxyURL                     *string `json:"proxy_url,omitempty"`
-	MaxRetries                   *int    `json:"max_retries,omitempty"`
-	BlacklistThreshold           *int    `json:"blacklist_threshold,omitempty"`
-	KeyValidationIntervalMinutes *int    `json:"key_validation_interval_minutes,omitempty"`
-	KeyValidationConcurrency     *int    `json:"key_validation_concurrency,omitempty"`
-	KeyValidationTimeoutSeconds  *int    `json:"key_validation_timeout_seconds,omitempty"`
+	RequestTimeout                     *int    `json:"request_timeout,omitempty"`
+	IdleConnTimeout                    *int    `json:"idle_conn_timeout,omitempty"`
+	ConnectTimeout                     *int    `json:"connect_timeout,omitempty"`
+	MaxIdleConns                       *int    `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost                *int    `json:"max_idle_conns_per_host,omitempty"`
+	ResponseHeaderTimeout              *int    `json:"response_header_timeout,omitempty"`
+	StreamFirstByteTimeout             *int    `json:"stream_first_byte_timeout,omitempty"`
+	StreamIdleTimeout                  *int    `json:"stream_idle_timeout,omitempty"`
+	MaxRequestBodySize                 *int    `json:"max_request_body_size,omitempty"`
+	RequestBodySpoolThreshold          *int    `json:"request_body_spool_threshold,omitempty"`
+	DebugResponseHeaders               *bool   `json:"debug_response_headers,omitempty"`
+	ProxyURL                           *string `json:"proxy_url,omitempty"`
+	WebSocketAllowedOrigins            *string `json:"websocket_allowed_origins,omitempty"`
+	UpstreamFailureThreshold           *int    `json:"upstream_failure_threshold,omitempty"`
+	UpstreamCircuitOpenSeconds         *int    `json:"upstream_circuit_open_seconds,omitempty"`
+	UpstreamHealthCheckPath            *string `json:"upstream_health_check_path,omitempty"`
+	UpstreamHealthCheckIntervalSeconds *int    `json:"upstream_health_check_interval_seconds,omitempty"`
+	UpstreamStrategy                   *string `json:"upstream_strategy,omitempty"`
+	MaxRetries                         *int    `json:"max_retries,omitempty"`
+	BlacklistThreshold                 *int    `json:"blacklist_threshold,omitempty"`
+	KeyValidationIntervalMinutes       *int    `json:"key_validation_interval_minutes,omitempty"`
+	KeyValidationConcurrency           *int    `json:"key_validation_concurrency,omitempty"`
+	KeyValidationTimeoutSeconds        *int    `json:"key_validation_timeout_seconds,omitempty"`
+	KeySelectionStrategy               *string `json:"key_selection_strategy,omitempty"`
+	KeyRpmLimit                        *int    `json:"key_rpm_limit,omitempty"`
+	KeyRpdLimit                        *int    `json:"key_rpd_limit,omitempty"`
+	QuotaResetTimezone                 *string `json:"quota_reset_timezone,omitempty"`
+	RetryStatusCodes                   *string `json:"retry_status_codes,omitempty"`
+	RetryErrorPatterns                 *string `json:"retry_error_patterns,omitempty"`
+	KeyPenaltyStatusCodes              *string `json:"key_penalty_status_codes,omitempty"`
+	KeyPenaltyErrorPatterns            *string `json:"key_penalty_error_patterns,omitempty"`
+	KeyCooldownSeconds                 *int    `json:"key_cooldown_seconds,omitempty"`
+	RetryBackoffMs                     *int    `json:"retry_backoff_ms,omitempty"`
+	RetryBackoffMaxMs                  *int    `json:"retry_backoff_max_ms,omitempty"`
+	FallbackStatusCodes                *string `json:"fallback_status_codes,omitempty"`
+	FallbackErrorPatterns              *string `json:"fallback_error_patterns,omitempty"`
+	ModelAllowlist                     *string `json:"model_allowlist,omitempty"`
+	ModelDenylist                      *string `json:"model_denylist,omitempty"`
+	ProxyKeyModelRules                 *string `json:"proxy_key_model_rules,omitempty"`
+	KeyAffinityEnabled                 *bool   `json:"key_affinity_enabled,omitempty"`
+	KeyAffinityHeader                  *string `json:"key_affinity_header,omitempty"`
+	KeyAffinityPrefixBytes             *int    `json:"key_affinity_prefix_bytes,omitempty"`
+	KeyAffinityTTLSeconds              *int    `json:"key_affinity_ttl_seconds,omitempty"`
+	ResponseCacheEnabled               *bool   `json:"response_cache_enabled,omitempty"`
+	ResponseCacheTTLSeconds            *int    `json:"response_cache_ttl_seconds,omitempty"`
+	ResponseCacheMaxBodySize           *int    `json:"response_cache_max_body_size,omitempty"`
+	PayloadCaptureEnabled              *bool   `json:"payload_capture_enabled,omitempty"`
+	PayloadCaptureSampleRate           *int    `json:"payload_capture_sample_rate,omitempty"`
+	PayloadCaptureMaxSize              *int    `json:"payload_capture_max_size,omitempty"`
+	PayloadStripBase64                 *bool   `json:"payload_strip_base64,omitempty"`
+	PayloadRedactFields                *string `json:"payload_redact_fields,omitempty"`
+	PayloadMaskPattern                 *string `json:"payload_mask_pattern,omitempty"`
 }
 
 // HeaderRule defines a single rule for header manipulation.
@@ -46,11 +93,55 @@ type HeaderRule struct {
 	Action string `json:"action"` // "set" or "remove"
 }
 
+// Param rule actions
+const (
+	ParamActionSet     = "set"     // 设置字段，必要时创建中间对象
+	ParamActionDefault = "default" // 仅在字段不存在时设置
+	ParamActionDelete  = "delete"  // 删除字段
+	ParamActionClamp   = "clamp"   // 将数值限制在 min 与 max 之间
+)
+
+// ParamRule rewrites a field of the JSON request body, addressed by a dot-separated path such as
+// generationConfig.thinkingConfig.thinkingBudget. Numeric segments index into arrays.
+// The rule only applies when the model and request path match one of the given glob patterns, if any.
+type ParamRule struct {
+	Path   string          `json:"path"`
+	Action string          `json:"action"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Min    *float64        `json:"min,omitempty"`
+	Max    *float64        `json:"max,omitempty"`
+	Models []string        `json:"models,omitempty"`
+	Paths  []string        `json:"paths,omitempty"`
+}
+
+// ModelFallback lists the models tried in order when a request for Model fails.
+// Model may be a glob pattern. A fallback is a model of the same group, or "group/model" for a model of another group.
+type ModelFallback struct {
+	Model     string   `json:"model"`
+	Fallbacks []string `json:"fallbacks"`
+}
+
+// PluginConfig is one step of a group's request transformation pipeline.
+// Config holds the plugin's own settings and is interpreted by the plugin.
+type PluginConfig struct {
+	Name   string          `json:"name"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// SubGroup is a member of an aggregate group. Lower priority values are tried first;
+// members with the same priority are picked by weight.
+type SubGroup struct {
+	GroupID  uint `json:"group_id"`
+	Weight   int  `json:"weight"`
+	Priority int  `json:"priority"`
+}
+
 // Group 对应 groups 表
 type Group struct {
 	ID                 uint                 `gorm:"primaryKey;autoIncrement" json:"id"`
 	EffectiveConfig    types.SystemSettings `gorm:"-" json:"effective_config,omitempty"`
 	Name               string               `gorm:"type:varchar(255);not null;unique" json:"name"`
+	GroupType          string               `gorm:"type:varchar(50);not null;default:'standard'" json:"group_type"`
 	Endpoint           string               `gorm:"-" json:"endpoint"`
 	DisplayName        string               `gorm:"type:varchar(255)" json:"display_name"`
 	ProxyKeys          string               `gorm:"type:text" json:"proxy_keys"`
@@ -58,19 +149,43 @@ type Group struct {
 	Upstreams          datatypes.JSON       `gorm:"type:json;not null" json:"upstreams"`
 	ValidationEndpoint string               `gorm:"type:varchar(255)" json:"validation_endpoint"`
 	ChannelType        string               `gorm:"type:varchar(50);not null" json:"channel_type"`
+	InboundFormat      string               `gorm:"type:varchar(50)" json:"inbound_format"`
 	Sort               int                  `gorm:"default:0" json:"sort"`
 	TestModel          string               `gorm:"type:varchar(255);not null" json:"test_model"`
 	ParamOverrides     datatypes.JSONMap    `gorm:"type:json" json:"param_overrides"`
+	ParamRules         datatypes.JSON       `gorm:"type:json" json:"param_rules"`
+	ModelMapping       datatypes.JSONMap    `gorm:"type:json" json:"model_mapping"`
+	ModelFallbacks     datatypes.JSON       `gorm:"type:json" json:"model_fallbacks"`
 	Config             datatypes.JSONMap    `gorm:"type:json" json:"config"`
 	HeaderRules        datatypes.JSON       `gorm:"type:json" json:"header_rules"`
+	Plugins            datatypes.JSON       `gorm:"type:json" json:"plugins"`
+	SubGroups          datatypes.JSON       `gorm:"type:json" json:"sub_groups"`
 	APIKeys            []APIKey             `gorm:"foreignKey:GroupID" json:"api_keys"`
 	LastValidatedAt    *time.Time           `json:"last_validated_at"`
 	CreatedAt          time.Time            `json:"created_at"`
 	UpdatedAt          time.Time            `json:"updated_at"`
 
 	// For cache
-	ProxyKeysMap   map[string]struct{} `gorm:"-" json:"-"`
-	HeaderRuleList []HeaderRule        `gorm:"-" json:"-"`
+	ProxyKeysMap    map[string]struct{} `gorm:"-" json:"-"`
+	HeaderRuleList  []HeaderRule        `gorm:"-" json:"-"`
+	PluginList      []PluginConfig      `gorm:"-" json:"-"`
+	ParamRuleList   []ParamRule         `gorm:"-" json:"-"`
+	ModelMappingMap map[string]string   `gorm:"-" json:"-"`
+	FallbackList    []ModelFallback     `gorm:"-" json:"-"`
+	SubGroupList    []SubGroup          `gorm:"-" json:"-"`
+}
+
+// IsAggregate reports whether the group routes requests to member groups instead of its own keys.
+func (g *Group) IsAggregate() bool {
+	return g.GroupType == GroupTypeAggregate
+}
+
+// ClientFormat returns the API format the clients of the group speak.
+func (g *Group) ClientFormat() string {
+	if g.InboundFormat != "" {
+		return g.InboundFormat
+	}
+	return g.ChannelType
 }
 
 // APIKey 对应 api_keys 表
@@ -81,6 +196,9 @@ type APIKey struct {
 	Status       string     `gorm:"type:varchar(50);not null;default:'active'" json:"status"`
 	RequestCount int64      `gorm:"not null;default:0" json:"request_count"`
 	FailureCount int64      `gorm:"not null;default:0" json:"failure_count"`
+	RpmLimit     int        `gorm:"not null;default:0" json:"rpm_limit"`
+	RpdLimit     int        `gorm:"not null;default:0" json:"rpd_limit"`
+	Weight       int        `gorm:"not null;default:1" json:"weight"`
 	LastUsedAt   *time.Time `json:"last_used_at"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
@@ -88,22 +206,69 @@ type APIKey struct {
 
 // RequestLog 对应 request_logs 表
 type RequestLog struct {
-	ID           string    `gorm:"type:varchar(36);primaryKey" json:"id"`
-	Timestamp    time.Time `gorm:"not null;index" json:"timestamp"`
-	GroupID      uint      `gorm:"not null;index" json:"group_id"`
-	GroupName    string    `gorm:"type:varchar(255);index" json:"group_name"`
-	KeyValue     string    `gorm:"type:varchar(700)" json:"key_value"`
-	Model        string    `gorm:"type:varchar(255);index" json:"model"`
-	IsSuccess    bool      `gorm:"not null" json:"is_success"`
-	SourceIP     string    `gorm:"type:varchar(64)" json:"source_ip"`
-	StatusCode   int       `gorm:"not null" json:"status_code"`
-	RequestPath  string    `gorm:"type:varchar(500)" json:"request_path"`
-	Duration     int64     `gorm:"not null" json:"duration_ms"`
-	ErrorMessage string    `gorm:"type:text" json:"error_message"`
-	UserAgent    string    `gorm:"type:varchar(512)" json:"user_agent"`
-	Retries      int       `gorm:"not null" json:"retries"`
-	UpstreamAddr string    `gorm:"type:varchar(500)" json:"upstream_addr"`
-	IsStream     bool      `gorm:"not null" json:"is_stream"`
+	ID                 string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Timestamp          time.Time `gorm:"not null;index" json:"timestamp"`
+	RequestID          string    `gorm:"type:varchar(128);index" json:"request_id"`
+	GroupID            uint      `gorm:"not null;index" json:"group_id"`
+	GroupName          string    `gorm:"type:varchar(255);index" json:"group_name"`
+	AggregateGroupID   uint      `gorm:"index" json:"aggregate_group_id,omitempty"`
+	AggregateGroupName string    `gorm:"type:varchar(255)" json:"aggregate_group_name,omitempty"`
+	KeyValue           string    `gorm:"type:varchar(700)" json:"key_value"`
+	Model              string    `gorm:"type:varchar(255);index" json:"model"`
+	UpstreamModel      string    `gorm:"type:varchar(255)" json:"upstream_model"`
+	IsSuccess          bool      `gorm:"not null" json:"is_success"`
+	SourceIP           string    `gorm:"type:varchar(64)" json:"source_ip"`
+	StatusCode         int       `gorm:"not null" json:"status_code"`
+	RequestPath        string    `gorm:"type:varchar(500)" json:"request_path"`
+	Duration           int64     `gorm:"not null" json:"duration_ms"`
+	ErrorMessage       string    `gorm:"type:text" json:"error_message"`
+	UserAgent          string    `gorm:"type:varchar(512)" json:"user_agent"`
+	Retries            int       `gorm:"not null" json:"retries"`
+	UpstreamAddr       string    `gorm:"type:varchar(500)" json:"upstream_addr"`
+	IsStream           bool      `gorm:"not null" json:"is_stream"`
+	IsCacheHit         bool      `gorm:"not null;default:false" json:"is_cache_hit"`
+	InputTokens        int64     `gorm:"not null;default:0" json:"input_tokens"`
+	OutputTokens       int64     `gorm:"not null;default:0" json:"output_tokens"`
+	CachedTokens       int64     `gorm:"not null;default:0" json:"cached_tokens"`
+	HasPayload         bool      `gorm:"not null;default:false" json:"has_payload"`
+	CloseCode          int       `gorm:"not null;default:0" json:"close_code,omitempty"` // WebSocket 会话的关闭码
+	Fallback           string    `gorm:"type:varchar(255)" json:"fallback,omitempty"`    // 实际响应请求的后备模型
+
+	// Payload is stored in its own table so that it can be kept for a shorter time than the log.
+	Payload *RequestPayload `gorm:"-" json:"payload,omitempty"`
+}
+
+// RequestPayload 对应 request_payloads 表，保存请求日志的请求体与响应体
+type RequestPayload struct {
+	LogID             string    `gorm:"type:varchar(36);primaryKey" json:"log_id"`
+	Timestamp         time.Time `gorm:"not null;index" json:"timestamp"`
+	RequestBody       string    `json:"request_body"` // 不指定类型，MySQL 下为 longtext
+	ResponseBody      string    `json:"response_body"`
+	RequestTruncated  bool      `gorm:"not null;default:false" json:"request_truncated"`
+	ResponseTruncated bool      `gorm:"not null;default:false" json:"response_truncated"`
+}
+
+// TokenUsage holds the token counts reported by an upstream response.
+type TokenUsage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	CachedTokens int64 `json:"cached_tokens"`
+}
+
+// Merge folds another usage report into this one, keeping the largest value of each counter.
+// Streaming providers report cumulative counts, so the largest value is the final one.
+func (u *TokenUsage) Merge(other *TokenUsage) {
+	if other == nil {
+		return
+	}
+	u.InputTokens = max(u.InputTokens, other.InputTokens)
+	u.OutputTokens = max(u.OutputTokens, other.OutputTokens)
+	u.CachedTokens = max(u.CachedTokens, other.CachedTokens)
+}
+
+// IsZero reports whether no tokens were recorded.
+func (u *TokenUsage) IsZero() bool {
+	return u == nil || (u.InputTokens == 0 && u.OutputTokens == 0 && u.CachedTokens == 0)
 }
 
 // StatCard 用于仪表盘的单个统计卡片数据
@@ -143,6 +308,9 @@ type GroupHourlyStat struct {
 	GroupID      uint      `gorm:"not null;uniqueIndex:idx_group_time" json:"group_id"`
 	SuccessCount int64     `gorm:"not null;default:0" json:"success_count"`
 	FailureCount int64     `gorm:"not null;default:0" json:"failure_count"`
+	InputTokens  int64     `gorm:"not null;default:0" json:"input_tokens"`
+	OutputTokens int64     `gorm:"not null;default:0" json:"output_tokens"`
+	CachedTokens int64     `gorm:"not null;default:0" json:"cached_tokens"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"gpt-load/internal/models"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	app_errors "gpt-load/internal/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// handleAggregateProxy serves a request through the member groups of an aggregate group,
+// failing over to the next member when one has no active keys or exhausts its retries.
+func (ps *ProxyServer) handleAggregateProxy(c *gin.Context, aggregate *models.Group, body *requestBody, startTime time.Time) {
+	members := ps.resolveSubGroups(aggregate)
+	if len(members) == 0 {
+		logrus.Warnf("Aggregate group %s has no available member groups", aggregate.Name)
+		apiErr := app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, "No member groups are available in aggregate group "+aggregate.Name)
+		pr := &proxyRequest{group: aggregate, startTime: startTime}
+		ps.respondError(c, pr, apiErr)
+		ps.logRequest(c, pr, nil, http.StatusServiceUnavailable, 0, apiErr, "", nil)
+		return
+	}
+
+	// Objects such as files only exist in the member group whose key created them.
+	members = ps.preferResourceOwner(members, referencedResourceIDs(c.Request.URL.Path, body.bytes()))
+
+	// Members whose model rules deny the requested model are left out of the failover order.
+	var prepared []*proxyRequest
+	var deniedPR *proxyRequest
+	var denied error
+	for _, member := range members {
+		pr, ok := ps.prepareRequest(c, member, aggregate.Name, body, startTime)
+		if !ok {
+			return
+		}
+		pr.aggregateGroup = aggregate
+		if err := checkModelAccess(c, aggregate, pr.model, ""); err != nil {
+			ps.rejectModel(c, pr, err)
+			return
+		}
+		err := checkModelAccess(c, member, pr.model, pr.upstreamModel)
+		if err == nil && pr.upstreamModel != "" {
+			// The aggregate's rules also cover the model the member maps the request to.
+			err = checkModelAccess(c, aggregate, pr.upstreamModel, "")
+		}
+		if err != nil {
+			logrus.Debugf("Skipping member group %s of aggregate group %s: %v", member.Name, aggregate.Name, err)
+			deniedPR, denied = pr, err
+			continue
+		}
+		prepared = append(prepared, pr)
+	}
+	if len(prepared) == 0 {
+		ps.rejectModel(c, deniedPR, denied)
+		return
+	}
+
+	for i, pr := range prepared {
+		pr.canFailover = i < len(prepared)-1
+		if ps.executeRequestWithRetry(c, pr, 0, nil) {
+			return
+		}
+	}
+}
+
+// resolveSubGroups returns the member groups of an aggregate in the order they should be tried:
+// by ascending priority, and in weighted random order among members of the same priority.
+func (ps *ProxyServer) resolveSubGroups(aggregate *models.Group) []*models.Group {
+	byPriority := make(map[int][]models.SubGroup)
+	var priorities []int
+	for _, sg := range aggregate.SubGroupList {
+		if _, ok := byPriority[sg.Priority]; !ok {
+			priorities = append(priorities, sg.Priority)
+		}
+		byPriority[sg.Priority] = append(byPriority[sg.Priority], sg)
+	}
+	sort.Ints(priorities)
+
+	var members []*models.Group
+	for _, priority := range priorities {
+		for _, sg := range weightedShuffle(byPriority[priority]) {
+			member, err := ps.groupManager.GetGroupByID(sg.GroupID)
+			if err != nil {
+				logrus.Warnf("Member group %d of aggregate group %s not found, skipping", sg.GroupID, aggregate.Name)
+				continue
+			}
+			if member.IsAggregate() {
+				continue
+			}
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// weightedShuffle orders sub groups by repeatedly drawing one at random in proportion to its weight.
+func weightedShuffle(subGroups []models.SubGroup) []models.SubGroup {
+	remaining := append([]models.SubGroup(nil), subGroups...)
+	ordered := make([]models.SubGroup, 0, len(remaining))
+	for len(remaining) > 0 {
+		total := 0
+		for _, sg := range remaining {
+			total += max(sg.Weight, 1)
+		}
+		pick := rand.Intn(total)
+		idx := 0
+		for i, sg := range remaining {
+			pick -= max(sg.Weight, 1)
+			if pick < 0 {
+				idx = i
+				break
+			}
+		}
+		ordered = append(ordered, remaining[idx])
+		remaining = append(remaining[:idx], remaining[idx+1:]...)
+	}
+	return ordered
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"strings"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// fallbacksFor returns the fallback models left to try for a request.
+// The chain is taken from the group the client addressed, for the model the client requested.
+func fallbacksFor(pr *proxyRequest) []string {
+	if pr.fallback != "" {
+		return pr.fallbacks
+	}
+	if pr.model == "" || pr.rawBody != nil {
+		// Spooled and streamed bodies are not JSON, so the model cannot be rewritten.
+		return nil
+	}
+	entry := pr.group
+	if pr.aggregateGroup != nil {
+		entry = pr.aggregateGroup
+	}
+	for _, fallback := range entry.FallbackList {
+		if utils.MatchGlob(fallback.Model, pr.model) {
+			return fallback.Fallbacks
+		}
+	}
+	return nil
+}
+
+// serveFallback sends a failed request to the next fallback model of its chain.
+// It returns false without writing a response when no fallback is left.
+func (ps *ProxyServer) serveFallback(c *gin.Context, pr *proxyRequest) bool {
+	remaining := fallbacksFor(pr)
+	for len(remaining) > 0 {
+		target := remaining[0]
+		remaining = remaining[1:]
+
+		group, model := ps.resolveFallback(pr, target)
+		if group == nil {
+			logrus.Warnf("Skipping fallback '%s' for model %s: group not found", target, pr.model)
+			continue
+		}
+		prepared, ok, written := ps.prepareFallback(c, pr, group, model)
+		if written {
+			return true
+		}
+		if !ok {
+			continue
+		}
+
+		logrus.Debugf("Request for model %s failed in group %s, falling back to %s", pr.model, pr.group.Name, target)
+		for i, fpr := range prepared {
+			fpr.fallback = target
+			fpr.fallbacks = remaining
+			fpr.canFailover = i < len(prepared)-1
+			if ps.executeRequestWithRetry(c, fpr, 0, nil) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveFallback splits a fallback into its group and model. A fallback whose prefix before the first slash
+// names a group is a model of that group; otherwise it is a model of the group the client addressed,
+// which keeps model names containing slashes usable.
+func (ps *ProxyServer) resolveFallback(pr *proxyRequest, target string) (*models.Group, string) {
+	if groupName, model, found := strings.Cut(target, "/"); found {
+		if group, err := ps.groupManager.GetGroupByName(groupName); err == nil {
+			return group, model
+		}
+	}
+	group, err := ps.groupManager.GetGroupByName(pr.entryName)
+	if err != nil {
+		return nil, ""
+	}
+	return group, target
+}
+
+// prepareFallback builds the requests for a fallback model: the client's request, prepared for the group
+// as usual, with the model replaced after format translation, as model mapping does.
+// An aggregate group yields one request per member that allows the model. The fallback model and the
+// upstream model it maps to must pass the rules of the group the client addressed as well as its own.
+// written is true when an error response has been written and the request must end.
+func (ps *ProxyServer) prepareFallback(c *gin.Context, pr *proxyRequest, group *models.Group, model string) (prepared []*proxyRequest, ok bool, written bool) {
+	entry, err := ps.groupManager.GetGroupByName(pr.entryName)
+	if err != nil {
+		return nil, false, false
+	}
+	members := []*models.Group{group}
+	if group.IsAggregate() {
+		members = ps.resolveSubGroups(group)
+	}
+	if err := checkModelAccess(c, group, model, ""); err != nil {
+		logrus.Debugf("Skipping fallback model %s of group %s: %v", model, group.Name, err)
+		return nil, false, false
+	}
+
+	for _, member := range members {
+		fpr, ok := ps.prepareRequest(c, member, pr.entryName, pr.body, pr.startTime)
+		if !ok {
+			return nil, false, true
+		}
+		if member != group {
+			fpr.aggregateGroup = group
+		}
+
+		upstreamModel := model
+		if mapped, ok := member.ModelMappingMap[model]; ok {
+			upstreamModel = mapped
+		}
+		if err := fallbackAccess(c, entry, group, member, model, upstreamModel); err != nil {
+			logrus.Debugf("Skipping fallback model %s of group %s: %v", model, member.Name, err)
+			continue
+		}
+		requestURL, body, err := fpr.channelHandler.RewriteModel(fpr.requestURL, fpr.bodyBytes, upstreamModel)
+		if err != nil {
+			logrus.Warnf("Skipping fallback model %s of group %s: %v", model, member.Name, err)
+			continue
+		}
+		fpr.requestURL, fpr.bodyBytes, fpr.upstreamModel = requestURL, body, upstreamModel
+		fpr.pluginCtx.RequestURL, fpr.pluginCtx.Body, fpr.pluginCtx.UpstreamModel = requestURL, body, upstreamModel
+		// Responses are cached under the requested model, so a fallback answer must not be stored.
+		fpr.cacheKey = ""
+		prepared = append(prepared, fpr)
+	}
+	return prepared, len(prepared) > 0, false
+}
+
+// fallbackAccess checks a fallback model, and the upstream model a member maps it to, against the member,
+// the fallback group when it is an aggregate, and the entry group the client addressed.
+func fallbackAccess(c *gin.Context, entry, group, member *models.Group, model, upstreamModel string) error {
+	if err := checkModelAccess(c, member, model, upstreamModel); err != nil {
+		return err
+	}
+	if member != group {
+		if err := checkModelAccess(c, group, upstreamModel, ""); err != nil {
+			return err
+		}
+	}
+	if entry != group && entry != member {
+		return checkModelAccess(c, entry, model, upstreamModel)
+	}
+	return nil
+}
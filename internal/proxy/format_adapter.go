@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gpt-load/internal/channel"
+	"io"
+	"sort"
+)
+
+// InboundFormatNative means requests are passed through in the group's own channel format.
+const InboundFormatNative = ""
+
+// convertedRequest is the native-format request produced by a formatAdapter.
+type convertedRequest struct {
+	Body     []byte
+	Path     string
+	RawQuery string
+	Model    string
+	IsStream bool
+}
+
+// formatAdapter translates between a client-facing API format and a group's native channel format.
+// An adapter instance is created per request, so it may keep request state for the response side.
+type formatAdapter interface {
+	// Matches reports whether the request path (relative to the group endpoint) is handled by the adapter.
+	Matches(method, path string) bool
+
+	// ConvertRequest translates an inbound request body into the native channel format.
+	ConvertRequest(body []byte) (*convertedRequest, error)
+
+	// ConvertResponse translates a native non-streaming response body.
+	ConvertResponse(body []byte) ([]byte, error)
+
+	// NewStreamConverter creates a converter for the native event stream of this request.
+	NewStreamConverter() streamConverter
+
+	// ConvertError translates a native error body into the inbound format's error envelope.
+	ConvertError(statusCode int, body []byte) []byte
+}
+
+// streamConverter translates native SSE events into inbound-format SSE bytes.
+type streamConverter interface {
+	// Convert translates one native event into zero or more inbound-format events.
+	Convert(event string, data []byte) ([]byte, error)
+
+	// Finish returns any trailing events once the native stream has ended.
+	Finish() []byte
+}
+
+// adapterConstructor creates a new adapter bound to the group's channel.
+type adapterConstructor func(channelHandler channel.ChannelProxy) formatAdapter
+
+// adapterRegistry maps an inbound format to the channel types it can be served from.
+var adapterRegistry = make(map[string]map[string]adapterConstructor)
+
+// registerAdapter adds a format adapter for the given inbound format and native channel type.
+func registerAdapter(inboundFormat, channelType string, constructor adapterConstructor) {
+	if _, ok := adapterRegistry[inboundFormat]; !ok {
+		adapterRegistry[inboundFormat] = make(map[string]adapterConstructor)
+	}
+	if _, exists := adapterRegistry[inboundFormat][channelType]; exists {
+		panic(fmt.Sprintf("format adapter '%s' -> '%s' is already registered", inboundFormat, channelType))
+	}
+	adapterRegistry[inboundFormat][channelType] = constructor
+}
+
+// SupportedInboundFormats returns the inbound formats that can be served by the given channel type.
+func SupportedInboundFormats(channelType string) []string {
+	var formats []string
+	for format, channels := range adapterRegistry {
+		if _, ok := channels[channelType]; ok {
+			formats = append(formats, format)
+		}
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// IsSupportedInboundFormat checks whether the inbound format can be used with the channel type.
+func IsSupportedInboundFormat(inboundFormat, channelType string) bool {
+	if inboundFormat == InboundFormatNative {
+		return true
+	}
+	_, ok := adapterRegistry[inboundFormat][channelType]
+	return ok
+}
+
+// newFormatAdapter returns the adapter for the request, or nil if it should be passed through unchanged.
+func newFormatAdapter(inboundFormat, channelType string, channelHandler channel.ChannelProxy, method, path string) formatAdapter {
+	if inboundFormat == InboundFormatNative {
+		return nil
+	}
+	constructor, ok := adapterRegistry[inboundFormat][channelType]
+	if !ok {
+		return nil
+	}
+	adapter := constructor(channelHandler)
+	if !adapter.Matches(method, path) {
+		return nil
+	}
+	return adapter
+}
+
+// sseEvent is a single server-sent event.
+type sseEvent struct {
+	Event string
+	Data  []byte
+}
+
+// readSSEEvents parses server-sent events from r and calls fn for each of them.
+func readSSEEvents(r io.Reader, fn func(ev sseEvent) error) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+
+	var eventName string
+	var data bytes.Buffer
+	dispatch := func() error {
+		if data.Len() == 0 && eventName == "" {
+			return nil
+		}
+		ev := sseEvent{Event: eventName, Data: bytes.Clone(data.Bytes())}
+		eventName = ""
+		data.Reset()
+		return fn(ev)
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+			switch {
+			case len(line) == 0:
+				if dispatchErr := dispatch(); dispatchErr != nil {
+					return dispatchErr
+				}
+			case bytes.HasPrefix(line, []byte("data:")):
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.Write(bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" ")))
+			case bytes.HasPrefix(line, []byte("event:")):
+				eventName = string(bytes.TrimSpace(bytes.TrimPrefix(line, []byte("event:"))))
+			}
+		}
+		if err == io.EOF {
+			return dispatch()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// formatSSE encodes a server-sent event.
+func formatSSE(event string, data []byte) []byte {
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(event)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	return buf.Bytes()
+}
+
+// formatSSEJSON encodes v as the data of a server-sent event.
+func formatSSEJSON(event string, v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return formatSSE(event, data), nil
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gpt-load/internal/channel"
+)
+
+// assertJSONEqual compares two JSON documents semantically, ignoring the given top-level fields.
+func assertJSONEqual(t *testing.T, got []byte, want string, ignore ...string) {
+	t.Helper()
+	var gotValue, wantValue map[string]any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid expected JSON %s: %v", want, err)
+	}
+	for _, field := range ignore {
+		delete(gotValue, field)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestConvertRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		adapter  adapterConstructor
+		body     string
+		wantPath string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:    "openai to anthropic",
+			adapter: newOpenAIToAnthropicAdapter,
+			body: `{"model":"claude-sonnet-4","max_tokens":100,"temperature":1.5,"stop":"END","user":"u1",
+				"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`,
+			wantPath: "/v1/messages",
+			want: `{"model":"claude-sonnet-4","max_tokens":100,"temperature":1,"stop_sequences":["END"],
+				"system":"Be brief.","metadata":{"user_id":"u1"},
+				"messages":[{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`,
+		},
+		{
+			name:    "openai to anthropic tool round trip",
+			adapter: newOpenAIToAnthropicAdapter,
+			body: `{"model":"claude-sonnet-4","messages":[
+				{"role":"user","content":"Weather?"},
+				{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},
+				{"role":"tool","tool_call_id":"call_1","content":"sunny"}],
+				"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object"}}}],
+				"tool_choice":"required","parallel_tool_calls":false}`,
+			wantPath: "/v1/messages",
+			want: `{"model":"claude-sonnet-4","max_tokens":4096,
+				"messages":[
+					{"role":"user","content":[{"type":"text","text":"Weather?"}]},
+					{"role":"assistant","content":[{"type":"tool_use","id":"call_1","name":"weather","input":{"city":"Paris"}}]},
+					{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","content":"sunny"}]}],
+				"tools":[{"name":"weather","input_schema":{"type":"object"}}],
+				"tool_choice":{"type":"any","disable_parallel_tool_use":true}}`,
+		},
+		{
+			name:     "openai to anthropic reasoning effort",
+			adapter:  newOpenAIToAnthropicAdapter,
+			body:     `{"model":"claude-sonnet-4","max_tokens":16000,"reasoning_effort":"medium","messages":[{"role":"user","content":"Hi"}]}`,
+			wantPath: "/v1/messages",
+			want: `{"model":"claude-sonnet-4","max_tokens":16000,"thinking":{"type":"enabled","budget_tokens":8192},
+				"messages":[{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`,
+		},
+		{
+			name:     "openai to anthropic reasoning budget below max tokens",
+			adapter:  newOpenAIToAnthropicAdapter,
+			body:     `{"model":"claude-sonnet-4","reasoning_effort":"high","messages":[{"role":"user","content":"Hi"}]}`,
+			wantPath: "/v1/messages",
+			want: `{"model":"claude-sonnet-4","max_tokens":4096,"thinking":{"type":"enabled","budget_tokens":4095},
+				"messages":[{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`,
+		},
+		{
+			name:    "openai to anthropic max tokens too small for reasoning",
+			adapter: newOpenAIToAnthropicAdapter,
+			body:    `{"model":"claude-sonnet-4","max_tokens":500,"reasoning_effort":"low","messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "openai to anthropic invalid reasoning effort",
+			adapter: newOpenAIToAnthropicAdapter,
+			body:    `{"model":"claude-sonnet-4","reasoning_effort":"extreme","messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "openai to anthropic rejects seed",
+			adapter: newOpenAIToAnthropicAdapter,
+			body:    `{"model":"claude-sonnet-4","seed":1,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "openai to anthropic rejects json response format",
+			adapter: newOpenAIToAnthropicAdapter,
+			body:    `{"model":"claude-sonnet-4","response_format":{"type":"json_object"},"messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "openai to anthropic rejects logit bias",
+			adapter: newOpenAIToAnthropicAdapter,
+			body:    `{"model":"claude-sonnet-4","logit_bias":{"50256":-100},"messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "openai to gemini",
+			adapter: newOpenAIToGeminiAdapter,
+			body: `{"model":"gemini-2.5-flash","max_completion_tokens":200,"n":2,"seed":7,
+				"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object"}}},
+				"messages":[{"role":"developer","content":"Be brief."},{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`,
+			wantPath: "/v1beta/models/gemini-2.5-flash:generateContent",
+			want: `{"contents":[{"role":"user","parts":[{"text":"Hi"}]}],
+				"systemInstruction":{"parts":[{"text":"Be brief."}]},
+				"generationConfig":{"maxOutputTokens":200,"candidateCount":2,"seed":7,
+					"responseMimeType":"application/json","responseJsonSchema":{"type":"object"}}}`,
+		},
+		{
+			name:    "openai to gemini tool round trip",
+			adapter: newOpenAIToGeminiAdapter,
+			body: `{"model":"gemini-2.5-flash","reasoning_effort":"none","messages":[
+				{"role":"user","content":"Weather?"},
+				{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},
+				{"role":"tool","tool_call_id":"call_1","content":"sunny"}],
+				"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object","additionalProperties":false}}}],
+				"tool_choice":{"type":"function","function":{"name":"weather"}}}`,
+			wantPath: "/v1beta/models/gemini-2.5-flash:generateContent",
+			want: `{"contents":[
+					{"role":"user","parts":[{"text":"Weather?"}]},
+					{"role":"model","parts":[{"functionCall":{"name":"weather","args":{"city":"Paris"}}}]},
+					{"role":"user","parts":[{"functionResponse":{"name":"weather","response":{"content":"sunny"}}}]}],
+				"generationConfig":{"thinkingConfig":{"thinkingBudget":0}},
+				"tools":[{"functionDeclarations":[{"name":"weather","parametersJsonSchema":{"type":"object","additionalProperties":false}}]}],
+				"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["weather"]}}}`,
+		},
+		{
+			name:    "openai to gemini rejects disabled parallel tool calls",
+			adapter: newOpenAIToGeminiAdapter,
+			body:    `{"model":"gemini-2.5-flash","parallel_tool_calls":false,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "openai to gemini rejects logprobs",
+			adapter: newOpenAIToGeminiAdapter,
+			body:    `{"model":"gemini-2.5-flash","logprobs":true,"top_logprobs":2,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "anthropic to openai",
+			adapter: newAnthropicToOpenAIAdapter,
+			body: `{"model":"gpt-4o","max_tokens":1024,"stream":true,"system":"Be brief.",
+				"thinking":{"type":"enabled","budget_tokens":2048},
+				"messages":[{"role":"user","content":"Hi"}],
+				"tools":[{"name":"weather","input_schema":{"type":"object"}}],
+				"tool_choice":{"type":"auto","disable_parallel_tool_use":true}}`,
+			wantPath: "/v1/chat/completions",
+			want: `{"model":"gpt-4o","max_completion_tokens":1024,"stream":true,"stream_options":{"include_usage":true},
+				"reasoning_effort":"medium","parallel_tool_calls":false,
+				"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}],
+				"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object"}}}],
+				"tool_choice":"auto"}`,
+		},
+		{
+			name:     "anthropic to openai without thinking",
+			adapter:  newAnthropicToOpenAIAdapter,
+			body:     `{"model":"gpt-4o","max_tokens":1024,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantPath: "/v1/chat/completions",
+			want:     `{"model":"gpt-4o","max_tokens":1024,"messages":[{"role":"user","content":"Hi"}]}`,
+		},
+		{
+			name:    "anthropic to openai rejects top k",
+			adapter: newAnthropicToOpenAIAdapter,
+			body:    `{"model":"gpt-4o","max_tokens":1024,"top_k":40,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted, err := tt.adapter(nil).ConvertRequest([]byte(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ConvertRequest() = %s, want error", converted.Body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConvertRequest() error = %v", err)
+			}
+			if converted.Path != tt.wantPath {
+				t.Fatalf("ConvertRequest() path = %s, want %s", converted.Path, tt.wantPath)
+			}
+			assertJSONEqual(t, converted.Body, tt.want)
+		})
+	}
+}
+
+func TestConvertResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		adapter formatAdapter
+		request string
+		body    string
+		want    string
+	}{
+		{
+			name:    "anthropic to openai",
+			adapter: newOpenAIToAnthropicAdapter(&channel.AnthropicChannel{}),
+			body: `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4",
+				"content":[{"type":"thinking","thinking":"Look it up."},{"type":"tool_use","id":"toolu_1","name":"weather","input":{"city":"Paris"}}],
+				"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":4}}`,
+			want: `{"id":"msg_1","object":"chat.completion","model":"claude-sonnet-4",
+				"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","reasoning_content":"Look it up.",
+					"tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]}}],
+				"usage":{"prompt_tokens":14,"completion_tokens":5,"total_tokens":19,"prompt_tokens_details":{"cached_tokens":4}}}`,
+		},
+		{
+			name:    "gemini to openai",
+			adapter: newOpenAIToGeminiAdapter(&channel.GeminiChannel{}),
+			request: `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"Hi"}]}`,
+			body: `{"responseId":"resp_1","candidates":[{"content":{"role":"model","parts":[{"text":"Hel"},{"text":"lo"}]},"finishReason":"MAX_TOKENS"}],
+				"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5}}`,
+			want: `{"id":"resp_1","object":"chat.completion","model":"gemini-2.5-flash",
+				"choices":[{"index":0,"finish_reason":"length","message":{"role":"assistant","content":"Hello"}}],
+				"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+		},
+		{
+			name:    "openai to anthropic",
+			adapter: newAnthropicToOpenAIAdapter(&channel.OpenAIChannel{}),
+			body: `{"id":"chatcmpl_1","object":"chat.completion","model":"gpt-4o",
+				"choices":[{"index":0,"finish_reason":"length","message":{"role":"assistant","content":"Hello"}}],
+				"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			want: `{"id":"chatcmpl_1","type":"message","role":"assistant","model":"gpt-4o",
+				"content":[{"type":"text","text":"Hello"}],"stop_reason":"max_tokens","stop_sequence":null,
+				"usage":{"input_tokens":3,"output_tokens":2}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.request != "" {
+				if _, err := tt.adapter.ConvertRequest([]byte(tt.request)); err != nil {
+					t.Fatalf("ConvertRequest() error = %v", err)
+				}
+			}
+			got, err := tt.adapter.ConvertResponse([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("ConvertResponse() error = %v", err)
+			}
+			assertJSONEqual(t, got, tt.want, "created")
+		})
+	}
+}
@@ -0,0 +1,495 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"gpt-load/internal/channel"
+	"gpt-load/internal/models"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	registerAdapter("anthropic", "openai", newAnthropicToOpenAIAdapter)
+}
+
+// anthropicToOpenAIAdapter serves Anthropic Messages API requests from an OpenAI-compatible group.
+type anthropicToOpenAIAdapter struct {
+	channelHandler channel.ChannelProxy
+	request        anthropicRequest
+}
+
+func newAnthropicToOpenAIAdapter(channelHandler channel.ChannelProxy) formatAdapter {
+	return &anthropicToOpenAIAdapter{channelHandler: channelHandler}
+}
+
+func (a *anthropicToOpenAIAdapter) Matches(method, path string) bool {
+	return method == http.MethodPost && (path == "/v1/messages" || path == "/messages")
+}
+
+func (a *anthropicToOpenAIAdapter) ConvertRequest(body []byte) (*convertedRequest, error) {
+	if err := json.Unmarshal(body, &a.request); err != nil {
+		return nil, fmt.Errorf("invalid messages request: %w", err)
+	}
+	req := &a.request
+	if req.TopK != nil {
+		return nil, unsupportedParamsError([]string{"top_k"}, "openai")
+	}
+
+	out := openAIChatRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	reasoning := req.Thinking != nil && req.Thinking.Type == "enabled"
+	if req.MaxTokens > 0 {
+		maxTokens := req.MaxTokens
+		if reasoning {
+			// OpenAI reasoning models only accept max_completion_tokens, which also covers the reasoning tokens.
+			out.MaxCompletionTokens = &maxTokens
+		} else {
+			out.MaxTokens = &maxTokens
+		}
+	}
+	if len(req.StopSequences) > 0 {
+		out.Stop, _ = json.Marshal(req.StopSequences)
+	}
+	if req.Stream {
+		// Usage is only reported at the end of the stream when explicitly requested.
+		out.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if req.Metadata != nil {
+		out.User = req.Metadata.UserID
+	}
+	if reasoning {
+		out.ReasoningEffort = reasoningEffortForBudget(req.Thinking.BudgetTokens)
+	}
+
+	if system := anthropicContentText(req.System); system != "" {
+		content, _ := json.Marshal(system)
+		out.Messages = append(out.Messages, openAIMessage{Role: "system", Content: content})
+	}
+
+	for _, msg := range req.Messages {
+		blocks, err := parseAnthropicContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message content: %w", err)
+		}
+		switch msg.Role {
+		case "user":
+			messages, err := anthropicUserBlocksToOpenAI(blocks)
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = append(out.Messages, messages...)
+		case "assistant":
+			out.Messages = append(out.Messages, anthropicAssistantBlocksToOpenAI(blocks))
+		default:
+			return nil, fmt.Errorf("unsupported message role: %s", msg.Role)
+		}
+	}
+
+	for _, tool := range req.Tools {
+		out.Tools = append(out.Tools, openAITool{
+			Type: "function",
+			Function: openAIToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	out.ToolChoice = anthropicToolChoiceToOpenAI(req.ToolChoice)
+	if req.ToolChoice != nil && req.ToolChoice.DisableParallelToolUse && len(out.Tools) > 0 {
+		parallel := false
+		out.ParallelToolCalls = &parallel
+	}
+
+	converted, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chat completions request: %w", err)
+	}
+
+	return &convertedRequest{
+		Body:     converted,
+		Path:     "/v1/chat/completions",
+		Model:    req.Model,
+		IsStream: req.Stream,
+	}, nil
+}
+
+// anthropicUserBlocksToOpenAI converts a user turn. Tool results become separate "tool" messages,
+// which OpenAI requires to directly follow the assistant message that issued the calls.
+func anthropicUserBlocksToOpenAI(blocks []anthropicContentBlock) ([]openAIMessage, error) {
+	var messages []openAIMessage
+	var parts []openAIContentPart
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, openAIContentPart{Type: "text", Text: block.Text})
+		case "image":
+			if block.Source == nil {
+				continue
+			}
+			imageURL := block.Source.URL
+			if block.Source.Type == "base64" {
+				imageURL = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: imageURL}})
+		case "tool_result":
+			text := anthropicContentText(block.Content)
+			if block.IsError && text != "" {
+				text = "Error: " + text
+			}
+			content, _ := json.Marshal(text)
+			messages = append(messages, openAIMessage{Role: "tool", ToolCallID: block.ToolUseID, Content: content})
+		}
+	}
+
+	if len(parts) > 0 {
+		var content []byte
+		var err error
+		if len(parts) == 1 && parts[0].Type == "text" {
+			content, err = json.Marshal(parts[0].Text)
+		} else {
+			content, err = json.Marshal(parts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, openAIMessage{Role: "user", Content: content})
+	}
+	return messages, nil
+}
+
+// anthropicAssistantBlocksToOpenAI converts an assistant turn; thinking blocks are dropped.
+func anthropicAssistantBlocksToOpenAI(blocks []anthropicContentBlock) openAIMessage {
+	message := openAIMessage{Role: "assistant"}
+	var texts []string
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	if len(texts) > 0 || len(message.ToolCalls) == 0 {
+		message.Content, _ = json.Marshal(strings.Join(texts, ""))
+	}
+	return message
+}
+
+// anthropicToolChoiceToOpenAI converts an Anthropic tool_choice object.
+func anthropicToolChoiceToOpenAI(choice *anthropicToolChoice) json.RawMessage {
+	if choice == nil {
+		return nil
+	}
+	var value any
+	switch choice.Type {
+	case "auto":
+		value = "auto"
+	case "any":
+		value = "required"
+	case "none":
+		value = "none"
+	case "tool":
+		value = openAITool{Type: "function", Function: openAIToolFunction{Name: choice.Name}}
+	default:
+		return nil
+	}
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// openAIFinishReasonToAnthropic maps an OpenAI finish_reason to an Anthropic stop_reason.
+func openAIFinishReasonToAnthropic(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// toolInput returns the arguments of a tool call as a JSON object.
+func toolInput(arguments string) json.RawMessage {
+	trimmed := strings.TrimSpace(arguments)
+	if trimmed == "" || !json.Valid([]byte(trimmed)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(trimmed)
+}
+
+func (a *anthropicToOpenAIAdapter) ConvertResponse(body []byte) ([]byte, error) {
+	var resp openAIChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid chat completions response: %w", err)
+	}
+
+	out := &anthropicResponse{
+		ID:      resp.ID,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.Model,
+		Content: []anthropicContentBlock{},
+		Usage:   anthropicUsageFrom(a.channelHandler.ExtractUsage(body)),
+	}
+	if out.ID == "" {
+		out.ID = newAnthropicMessageID()
+	}
+
+	stopReason := "end_turn"
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if message := choice.Message; message != nil {
+			if message.Content != nil && *message.Content != "" {
+				out.Content = append(out.Content, anthropicContentBlock{Type: "text", Text: *message.Content})
+			}
+			for _, call := range message.ToolCalls {
+				out.Content = append(out.Content, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: toolInput(call.Function.Arguments),
+				})
+			}
+		}
+		if choice.FinishReason != nil {
+			stopReason = openAIFinishReasonToAnthropic(*choice.FinishReason)
+		}
+	}
+	out.StopReason = &stopReason
+
+	return json.Marshal(out)
+}
+
+func (a *anthropicToOpenAIAdapter) ConvertError(statusCode int, body []byte) []byte {
+	return buildAnthropicError(statusCode, body)
+}
+
+func (a *anthropicToOpenAIAdapter) NewStreamConverter() streamConverter {
+	return &openAIToAnthropicStream{
+		adapter:    a,
+		model:      a.request.Model,
+		blockIndex: -1,
+		toolBlocks: make(map[int]int),
+	}
+}
+
+// anthropicTextBlock is a text block that always serializes its text, as content_block_start requires.
+type anthropicTextBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// anthropicBlockStartEvent is the content_block_start event.
+type anthropicBlockStartEvent struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock any    `json:"content_block"`
+}
+
+// anthropicIndexedEvent is used for content_block_delta and content_block_stop.
+type anthropicIndexedEvent struct {
+	Type  string                `json:"type"`
+	Index int                   `json:"index"`
+	Delta *anthropicStreamDelta `json:"delta,omitempty"`
+}
+
+// openAIToAnthropicStream converts chat.completion.chunk events into the Messages API event sequence:
+// message_start, content_block_start/delta/stop per block, message_delta and message_stop.
+type openAIToAnthropicStream struct {
+	adapter    *anthropicToOpenAIAdapter
+	id         string
+	model      string
+	started    bool
+	blockIndex int
+	blockType  string
+	toolBlocks map[int]int
+	stopReason string
+	usage      models.TokenUsage
+}
+
+// start emits message_start once, before any content.
+func (s *openAIToAnthropicStream) start(out []byte) ([]byte, error) {
+	if s.started {
+		return out, nil
+	}
+	s.started = true
+	if s.id == "" {
+		s.id = newAnthropicMessageID()
+	}
+	event, err := formatSSEJSON("message_start", anthropicStreamEvent{
+		Type: "message_start",
+		Message: &anthropicResponse{
+			ID:      s.id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   s.model,
+			Content: []anthropicContentBlock{},
+			Usage:   anthropicUsageFrom(&s.usage),
+		},
+	})
+	if err != nil {
+		return out, err
+	}
+	return append(out, event...), nil
+}
+
+// closeBlock emits content_block_stop for the open block, if any.
+func (s *openAIToAnthropicStream) closeBlock(out []byte) []byte {
+	if s.blockType == "" {
+		return out
+	}
+	event, _ := formatSSEJSON("content_block_stop", anthropicIndexedEvent{Type: "content_block_stop", Index: s.blockIndex})
+	s.blockType = ""
+	return append(out, event...)
+}
+
+// openBlock closes the current block and starts a new one.
+func (s *openAIToAnthropicStream) openBlock(out []byte, blockType string, block any) ([]byte, error) {
+	out = s.closeBlock(out)
+	s.blockIndex++
+	s.blockType = blockType
+	event, err := formatSSEJSON("content_block_start", anthropicBlockStartEvent{
+		Type:         "content_block_start",
+		Index:        s.blockIndex,
+		ContentBlock: block,
+	})
+	if err != nil {
+		return out, err
+	}
+	return append(out, event...), nil
+}
+
+func (s *openAIToAnthropicStream) delta(out []byte, index int, delta *anthropicStreamDelta) ([]byte, error) {
+	event, err := formatSSEJSON("content_block_delta", anthropicIndexedEvent{
+		Type:  "content_block_delta",
+		Index: index,
+		Delta: delta,
+	})
+	if err != nil {
+		return out, err
+	}
+	return append(out, event...), nil
+}
+
+func (s *openAIToAnthropicStream) Convert(event string, data []byte) ([]byte, error) {
+	var chunk struct {
+		openAIChatResponse
+		Error *openAIErrorBody `json:"error"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, err
+	}
+
+	if chunk.Error != nil {
+		return formatSSEJSON("error", anthropicErrorResponse{
+			Type:  "error",
+			Error: anthropicErrorBody{Type: "api_error", Message: chunk.Error.Message},
+		})
+	}
+
+	s.usage.Merge(s.adapter.channelHandler.ExtractUsage(data))
+	if s.id == "" && chunk.ID != "" {
+		s.id = chunk.ID
+	}
+	if chunk.Model != "" {
+		s.model = chunk.Model
+	}
+
+	out, err := s.start(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 || choice.Delta == nil {
+			if choice.FinishReason != nil {
+				s.stopReason = openAIFinishReasonToAnthropic(*choice.FinishReason)
+			}
+			continue
+		}
+		delta := choice.Delta
+
+		if delta.Content != nil && *delta.Content != "" {
+			if s.blockType != "text" {
+				if out, err = s.openBlock(out, "text", anthropicTextBlock{Type: "text"}); err != nil {
+					return nil, err
+				}
+			}
+			if out, err = s.delta(out, s.blockIndex, &anthropicStreamDelta{Type: "text_delta", Text: *delta.Content}); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, call := range delta.ToolCalls {
+			toolIndex := i
+			if call.Index != nil {
+				toolIndex = *call.Index
+			}
+			blockIndex, ok := s.toolBlocks[toolIndex]
+			if !ok {
+				if out, err = s.openBlock(out, "tool_use", anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: json.RawMessage("{}"),
+				}); err != nil {
+					return nil, err
+				}
+				blockIndex = s.blockIndex
+				s.toolBlocks[toolIndex] = blockIndex
+			}
+			if call.Function.Arguments != "" {
+				if out, err = s.delta(out, blockIndex, &anthropicStreamDelta{Type: "input_json_delta", PartialJSON: call.Function.Arguments}); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if choice.FinishReason != nil {
+			s.stopReason = openAIFinishReasonToAnthropic(*choice.FinishReason)
+		}
+	}
+
+	return out, nil
+}
+
+func (s *openAIToAnthropicStream) Finish() []byte {
+	out, _ := s.start(nil)
+	out = s.closeBlock(out)
+
+	stopReason := s.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	usage := anthropicUsageFrom(&s.usage)
+	messageDelta, err := formatSSEJSON("message_delta", anthropicStreamEvent{
+		Type:  "message_delta",
+		Delta: &anthropicStreamDelta{StopReason: &stopReason},
+		Usage: &usage,
+	})
+	if err == nil {
+		out = append(out, messageDelta...)
+	}
+	messageStop, err := formatSSEJSON("message_stop", anthropicStreamEvent{Type: "message_stop"})
+	if err == nil {
+		out = append(out, messageStop...)
+	}
+	return out
+}
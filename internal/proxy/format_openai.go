@@ -0,0 +1,320 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"gpt-load/internal/channel"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"strings"
+	"time"
+)
+
+// openAIChatRequest is the subset of the Chat Completions request understood by the format adapters.
+type openAIChatRequest struct {
+	Model               string                `json:"model"`
+	Messages            []openAIMessage       `json:"messages"`
+	MaxTokens           *int                  `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                  `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64              `json:"temperature,omitempty"`
+	TopP                *float64              `json:"top_p,omitempty"`
+	N                   *int                  `json:"n,omitempty"`
+	Stop                json.RawMessage       `json:"stop,omitempty"`
+	Stream              bool                  `json:"stream,omitempty"`
+	StreamOptions       *openAIStreamOptions  `json:"stream_options,omitempty"`
+	Tools               []openAITool          `json:"tools,omitempty"`
+	ToolChoice          json.RawMessage       `json:"tool_choice,omitempty"`
+	PresencePenalty     *float64              `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float64              `json:"frequency_penalty,omitempty"`
+	Seed                *int64                `json:"seed,omitempty"`
+	ResponseFormat      *openAIResponseFormat `json:"response_format,omitempty"`
+	User                string                `json:"user,omitempty"`
+	ReasoningEffort     string                `json:"reasoning_effort,omitempty"`
+	ParallelToolCalls   *bool                 `json:"parallel_tool_calls,omitempty"`
+	LogitBias           map[string]float64    `json:"logit_bias,omitempty"`
+	Logprobs            bool                  `json:"logprobs,omitempty"`
+	TopLogprobs         *int                  `json:"top_logprobs,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIResponseFormat is "text", "json_object" or "json_schema" with its schema.
+type openAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+	Strict *bool           `json:"strict,omitempty"`
+}
+
+// openAIMessage is a chat message; Content is either a string, an array of parts or null.
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+type openAIToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    *int               `json:"index,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// openAIChatResponse is used both for complete responses and for stream chunks.
+type openAIChatResponse struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []openAIChoice      `json:"choices"`
+	Usage   *openAIUsagePayload `json:"usage,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int                    `json:"index"`
+	Message      *openAIResponseMessage `json:"message,omitempty"`
+	Delta        *openAIResponseMessage `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+type openAIResponseMessage struct {
+	Role             string           `json:"role,omitempty"`
+	Content          *string          `json:"content,omitempty"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+	ToolCalls        []openAIToolCall `json:"tool_calls,omitempty"`
+}
+
+type openAIUsagePayload struct {
+	PromptTokens        int64                      `json:"prompt_tokens"`
+	CompletionTokens    int64                      `json:"completion_tokens"`
+	TotalTokens         int64                      `json:"total_tokens"`
+	PromptTokensDetails *openAIPromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type openAIPromptTokensDetails struct {
+	CachedTokens int64 `json:"cached_tokens"`
+}
+
+// openAIErrorResponse is the OpenAI error envelope.
+type openAIErrorResponse struct {
+	Error openAIErrorBody `json:"error"`
+}
+
+type openAIErrorBody struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    any     `json:"code"`
+}
+
+// parseOpenAIContent normalizes message content into a list of parts.
+func parseOpenAIContent(raw json.RawMessage) ([]openAIContentPart, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, "\"") {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []openAIContentPart{{Type: "text", Text: text}}, nil
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+	return parts, nil
+}
+
+// openAIContentText concatenates the text parts of a message.
+func openAIContentText(raw json.RawMessage) string {
+	parts, err := parseOpenAIContent(raw)
+	if err != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// parseOpenAIStop accepts both the string and the array form of "stop".
+func parseOpenAIStop(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		if single == "" {
+			return nil
+		}
+		return []string{single}
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	return nil
+}
+
+// reasoningBudgets maps an OpenAI reasoning_effort to the thinking token budget used by Anthropic and Gemini.
+var reasoningBudgets = map[string]int{
+	"none":    0,
+	"minimal": 1024,
+	"low":     1024,
+	"medium":  8192,
+	"high":    24576,
+}
+
+// reasoningBudget returns the thinking token budget for a reasoning_effort value.
+func reasoningBudget(effort string) (int, error) {
+	budget, ok := reasoningBudgets[effort]
+	if !ok {
+		return 0, fmt.Errorf("invalid reasoning_effort: %s", effort)
+	}
+	return budget, nil
+}
+
+// reasoningEffortForBudget maps a thinking token budget back to the closest reasoning_effort.
+func reasoningEffortForBudget(budget int) string {
+	switch {
+	case budget <= 1024:
+		return "low"
+	case budget <= 8192:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// checkUnsupportedOpenAIParams rejects the Chat Completions parameters that a translated request cannot honor,
+// so that they are not silently dropped. Parameters that the adapter maps itself are checked by the adapter.
+func checkUnsupportedOpenAIParams(req *openAIChatRequest, target string) error {
+	var unsupported []string
+	if len(req.LogitBias) > 0 {
+		unsupported = append(unsupported, "logit_bias")
+	}
+	if req.Logprobs || req.TopLogprobs != nil {
+		unsupported = append(unsupported, "logprobs")
+	}
+	if len(unsupported) > 0 {
+		return unsupportedParamsError(unsupported, target)
+	}
+	return nil
+}
+
+// unsupportedParamsError reports request parameters that have no equivalent in the target format.
+func unsupportedParamsError(params []string, target string) error {
+	return fmt.Errorf("unsupported parameter(s) for a %s upstream: %s", target, strings.Join(params, ", "))
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload.
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, payload, found := strings.Cut(rest, ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), payload, true
+}
+
+// openAIUsageFrom converts collected token usage into an OpenAI usage block.
+func openAIUsageFrom(usage *models.TokenUsage) *openAIUsagePayload {
+	if usage == nil {
+		return nil
+	}
+	payload := &openAIUsagePayload{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.InputTokens + usage.OutputTokens,
+	}
+	if usage.CachedTokens > 0 {
+		payload.PromptTokensDetails = &openAIPromptTokensDetails{CachedTokens: usage.CachedTokens}
+	}
+	return payload
+}
+
+// newOpenAIChunk creates a chat.completion.chunk with a single choice.
+func newOpenAIChunk(id, model string, created int64, delta *openAIResponseMessage, finishReason *string) *openAIChatResponse {
+	return &openAIChatResponse{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   model,
+		Choices: []openAIChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}
+}
+
+// newOpenAIChatID generates a completion ID for upstreams that do not provide one.
+func newOpenAIChatID() string {
+	return fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+}
+
+// buildOpenAIError creates an OpenAI error envelope from a native upstream error body.
+func buildOpenAIError(statusCode int, body []byte) []byte {
+	errType := channel.ErrorTypeForStatus(statusCode)
+
+	// Keep the upstream error type when it is a known Anthropic type (e.g. overloaded_error).
+	var anthropicErr struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &anthropicErr); err == nil && anthropicErr.Type == "error" && anthropicErr.Error.Type != "" {
+		errType = anthropicErr.Error.Type
+	}
+
+	data, _ := json.Marshal(openAIErrorResponse{Error: openAIErrorBody{
+		Message: app_errors.ParseUpstreamError(body),
+		Type:    errType,
+		Code:    statusCode,
+	}})
+	return data
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,453 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"gpt-load/internal/channel"
+	"gpt-load/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerAdapter("openai", "anthropic", newOpenAIToAnthropicAdapter)
+}
+
+// openAIToAnthropicAdapter serves OpenAI Chat Completions requests from an Anthropic group.
+type openAIToAnthropicAdapter struct {
+	channelHandler channel.ChannelProxy
+	request        openAIChatRequest
+}
+
+func newOpenAIToAnthropicAdapter(channelHandler channel.ChannelProxy) formatAdapter {
+	return &openAIToAnthropicAdapter{channelHandler: channelHandler}
+}
+
+// isOpenAIChatPath reports whether the path is the Chat Completions endpoint.
+func isOpenAIChatPath(method, path string) bool {
+	return method == http.MethodPost && (path == "/v1/chat/completions" || path == "/chat/completions")
+}
+
+func (a *openAIToAnthropicAdapter) Matches(method, path string) bool {
+	return isOpenAIChatPath(method, path)
+}
+
+func (a *openAIToAnthropicAdapter) ConvertRequest(body []byte) (*convertedRequest, error) {
+	if err := json.Unmarshal(body, &a.request); err != nil {
+		return nil, fmt.Errorf("invalid chat completions request: %w", err)
+	}
+	req := &a.request
+	if err := checkAnthropicUnsupportedParams(req); err != nil {
+		return nil, err
+	}
+
+	out := anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     anthropicDefaultMaxTokens,
+		TopP:          req.TopP,
+		StopSequences: parseOpenAIStop(req.Stop),
+		Stream:        req.Stream,
+	}
+	if req.MaxCompletionTokens != nil {
+		out.MaxTokens = *req.MaxCompletionTokens
+	} else if req.MaxTokens != nil {
+		out.MaxTokens = *req.MaxTokens
+	}
+	if req.Temperature != nil {
+		// OpenAI accepts 0-2 while Anthropic accepts 0-1.
+		temperature := min(*req.Temperature, 1)
+		out.Temperature = &temperature
+	}
+	if req.User != "" {
+		out.Metadata = &anthropicMetadata{UserID: req.User}
+	}
+	if req.ReasoningEffort != "" {
+		budget, err := reasoningBudget(req.ReasoningEffort)
+		if err != nil {
+			return nil, err
+		}
+		if budget > 0 {
+			// The thinking budget counts towards max_tokens and must leave room for the answer.
+			budget = min(budget, out.MaxTokens-1)
+			if budget < anthropicMinThinkingBudget {
+				return nil, fmt.Errorf("max_tokens must be greater than %d to use reasoning_effort", anthropicMinThinkingBudget)
+			}
+			out.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		}
+	}
+
+	var systemTexts []string
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			if text := openAIContentText(msg.Content); text != "" {
+				systemTexts = append(systemTexts, text)
+			}
+		case "user":
+			blocks, err := openAIPartsToAnthropicBlocks(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = appendAnthropicMessage(out.Messages, "user", blocks)
+		case "assistant":
+			blocks, err := openAIPartsToAnthropicBlocks(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) || len(strings.TrimSpace(call.Function.Arguments)) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+			out.Messages = appendAnthropicMessage(out.Messages, "assistant", blocks)
+		case "tool":
+			content, _ := json.Marshal(openAIContentText(msg.Content))
+			out.Messages = appendAnthropicMessage(out.Messages, "user", []anthropicContentBlock{{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   content,
+			}})
+		default:
+			return nil, fmt.Errorf("unsupported message role: %s", msg.Role)
+		}
+	}
+	if len(systemTexts) > 0 {
+		system, _ := json.Marshal(strings.Join(systemTexts, "\n\n"))
+		out.System = system
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	out.ToolChoice = openAIToolChoiceToAnthropic(req.ToolChoice)
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls && len(out.Tools) > 0 {
+		if out.ToolChoice == nil {
+			out.ToolChoice = &anthropicToolChoice{Type: "auto"}
+		}
+		if out.ToolChoice.Type != "none" {
+			out.ToolChoice.DisableParallelToolUse = true
+		}
+	}
+
+	converted, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal messages request: %w", err)
+	}
+
+	return &convertedRequest{
+		Body:     converted,
+		Path:     "/v1/messages",
+		Model:    req.Model,
+		IsStream: req.Stream,
+	}, nil
+}
+
+// anthropicMinThinkingBudget is the smallest budget_tokens accepted by Anthropic extended thinking.
+const anthropicMinThinkingBudget = 1024
+
+// checkAnthropicUnsupportedParams rejects Chat Completions parameters that the Messages API has no equivalent for.
+func checkAnthropicUnsupportedParams(req *openAIChatRequest) error {
+	if err := checkUnsupportedOpenAIParams(req, "anthropic"); err != nil {
+		return err
+	}
+	var unsupported []string
+	if req.N != nil && *req.N > 1 {
+		unsupported = append(unsupported, "n")
+	}
+	if req.Seed != nil {
+		unsupported = append(unsupported, "seed")
+	}
+	if req.PresencePenalty != nil && *req.PresencePenalty != 0 {
+		unsupported = append(unsupported, "presence_penalty")
+	}
+	if req.FrequencyPenalty != nil && *req.FrequencyPenalty != 0 {
+		unsupported = append(unsupported, "frequency_penalty")
+	}
+	if req.ResponseFormat != nil && req.ResponseFormat.Type != "" && req.ResponseFormat.Type != "text" {
+		unsupported = append(unsupported, "response_format")
+	}
+	if len(unsupported) > 0 {
+		return unsupportedParamsError(unsupported, "anthropic")
+	}
+	return nil
+}
+
+// openAIPartsToAnthropicBlocks converts text and image parts into Anthropic content blocks.
+func openAIPartsToAnthropicBlocks(content json.RawMessage) ([]anthropicContentBlock, error) {
+	parts, err := parseOpenAIContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []anthropicContentBlock
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			source := &anthropicImageSource{Type: "url", URL: part.ImageURL.URL}
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				source = &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+			}
+			blocks = append(blocks, anthropicContentBlock{Type: "image", Source: source})
+		}
+	}
+	return blocks, nil
+}
+
+// appendAnthropicMessage merges consecutive messages of the same role, as Anthropic requires alternation.
+func appendAnthropicMessage(messages []anthropicMessage, role string, blocks []anthropicContentBlock) []anthropicMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		existing, _ := parseAnthropicContent(messages[n-1].Content)
+		blocks = append(existing, blocks...)
+		messages = messages[:n-1]
+	}
+	content, _ := json.Marshal(blocks)
+	return append(messages, anthropicMessage{Role: role, Content: content})
+}
+
+// openAIToolChoiceToAnthropic converts "auto"/"none"/"required" or a named function choice.
+func openAIToolChoiceToAnthropic(raw json.RawMessage) *anthropicToolChoice {
+	if len(raw) == 0 {
+		return nil
+	}
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case "auto":
+			return &anthropicToolChoice{Type: "auto"}
+		case "required":
+			return &anthropicToolChoice{Type: "any"}
+		case "none":
+			return &anthropicToolChoice{Type: "none"}
+		}
+		return nil
+	}
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err == nil && named.Function.Name != "" {
+		return &anthropicToolChoice{Type: "tool", Name: named.Function.Name}
+	}
+	return nil
+}
+
+// anthropicStopReasonToOpenAI maps an Anthropic stop_reason to an OpenAI finish_reason.
+func anthropicStopReasonToOpenAI(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func (a *openAIToAnthropicAdapter) ConvertResponse(body []byte) ([]byte, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid messages response: %w", err)
+	}
+
+	message := &openAIResponseMessage{Role: "assistant"}
+	var texts, thoughts []string
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "thinking":
+			thoughts = append(thoughts, block.Thinking)
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	if len(texts) > 0 || len(message.ToolCalls) == 0 {
+		message.Content = stringPtr(strings.Join(texts, ""))
+	}
+	message.ReasoningContent = strings.Join(thoughts, "")
+
+	finishReason := "stop"
+	if resp.StopReason != nil {
+		finishReason = anthropicStopReasonToOpenAI(*resp.StopReason)
+	}
+
+	return json.Marshal(&openAIChatResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []openAIChoice{{Index: 0, Message: message, FinishReason: &finishReason}},
+		Usage:   openAIUsageFrom(a.channelHandler.ExtractUsage(body)),
+	})
+}
+
+func (a *openAIToAnthropicAdapter) ConvertError(statusCode int, body []byte) []byte {
+	return buildOpenAIError(statusCode, body)
+}
+
+func (a *openAIToAnthropicAdapter) NewStreamConverter() streamConverter {
+	return &anthropicToOpenAIStream{
+		adapter:      a,
+		model:        a.request.Model,
+		created:      time.Now().Unix(),
+		toolIndexes:  make(map[int]int),
+		includeUsage: a.request.StreamOptions != nil && a.request.StreamOptions.IncludeUsage,
+	}
+}
+
+// anthropicToOpenAIStream converts Messages API events into chat.completion.chunk events.
+type anthropicToOpenAIStream struct {
+	adapter      *openAIToAnthropicAdapter
+	id           string
+	model        string
+	created      int64
+	toolIndexes  map[int]int
+	usage        models.TokenUsage
+	includeUsage bool
+}
+
+func (s *anthropicToOpenAIStream) chunk(delta *openAIResponseMessage, finishReason *string) ([]byte, error) {
+	return formatSSEJSON("", newOpenAIChunk(s.id, s.model, s.created, delta, finishReason))
+}
+
+func (s *anthropicToOpenAIStream) Convert(event string, data []byte) ([]byte, error) {
+	var ev anthropicStreamEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil, err
+	}
+	s.usage.Merge(s.adapter.channelHandler.ExtractUsage(data))
+
+	switch ev.Type {
+	case "message_start":
+		if ev.Message != nil {
+			s.id = ev.Message.ID
+			if ev.Message.Model != "" {
+				s.model = ev.Message.Model
+			}
+		}
+		if s.id == "" {
+			s.id = newOpenAIChatID()
+		}
+		return s.chunk(&openAIResponseMessage{Role: "assistant", Content: stringPtr("")}, nil)
+
+	case "content_block_start":
+		if ev.ContentBlock == nil || ev.Index == nil {
+			return nil, nil
+		}
+		switch ev.ContentBlock.Type {
+		case "tool_use":
+			toolIndex := len(s.toolIndexes)
+			s.toolIndexes[*ev.Index] = toolIndex
+			return s.chunk(&openAIResponseMessage{ToolCalls: []openAIToolCall{{
+				Index:    &toolIndex,
+				ID:       ev.ContentBlock.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: ev.ContentBlock.Name},
+			}}}, nil)
+		case "text":
+			if ev.ContentBlock.Text != "" {
+				return s.chunk(&openAIResponseMessage{Content: stringPtr(ev.ContentBlock.Text)}, nil)
+			}
+		}
+		return nil, nil
+
+	case "content_block_delta":
+		if ev.Delta == nil {
+			return nil, nil
+		}
+		switch ev.Delta.Type {
+		case "text_delta":
+			return s.chunk(&openAIResponseMessage{Content: stringPtr(ev.Delta.Text)}, nil)
+		case "thinking_delta":
+			return s.chunk(&openAIResponseMessage{ReasoningContent: ev.Delta.Thinking}, nil)
+		case "input_json_delta":
+			if ev.Index == nil {
+				return nil, nil
+			}
+			toolIndex, ok := s.toolIndexes[*ev.Index]
+			if !ok {
+				return nil, nil
+			}
+			return s.chunk(&openAIResponseMessage{ToolCalls: []openAIToolCall{{
+				Index:    &toolIndex,
+				Function: openAIFunctionCall{Arguments: ev.Delta.PartialJSON},
+			}}}, nil)
+		}
+		return nil, nil
+
+	case "message_delta":
+		if ev.Delta == nil || ev.Delta.StopReason == nil {
+			return nil, nil
+		}
+		finishReason := anthropicStopReasonToOpenAI(*ev.Delta.StopReason)
+		return s.chunk(&openAIResponseMessage{}, &finishReason)
+
+	case "message_stop":
+		if !s.includeUsage {
+			return nil, nil
+		}
+		return formatSSEJSON("", &openAIChatResponse{
+			ID:      s.id,
+			Object:  "chat.completion.chunk",
+			Created: s.created,
+			Model:   s.model,
+			Choices: []openAIChoice{},
+			Usage:   openAIUsageFrom(&s.usage),
+		})
+
+	case "error":
+		if ev.Error == nil {
+			return nil, nil
+		}
+		return formatSSEJSON("", openAIErrorResponse{Error: openAIErrorBody{
+			Message: ev.Error.Message,
+			Type:    ev.Error.Type,
+		}})
+	}
+
+	return nil, nil
+}
+
+func (s *anthropicToOpenAIStream) Finish() []byte {
+	return formatSSE("", []byte("[DONE]"))
+}
@@ -0,0 +1,418 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"gpt-load/internal/channel"
+	"gpt-load/internal/models"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerAdapter("openai", "gemini", newOpenAIToGeminiAdapter)
+}
+
+// openAIToGeminiAdapter serves OpenAI Chat Completions requests from a Gemini group.
+type openAIToGeminiAdapter struct {
+	channelHandler channel.ChannelProxy
+	request        openAIChatRequest
+	model          string
+}
+
+func newOpenAIToGeminiAdapter(channelHandler channel.ChannelProxy) formatAdapter {
+	return &openAIToGeminiAdapter{channelHandler: channelHandler}
+}
+
+func (a *openAIToGeminiAdapter) Matches(method, path string) bool {
+	return isOpenAIChatPath(method, path)
+}
+
+func (a *openAIToGeminiAdapter) ConvertRequest(body []byte) (*convertedRequest, error) {
+	if err := json.Unmarshal(body, &a.request); err != nil {
+		return nil, fmt.Errorf("invalid chat completions request: %w", err)
+	}
+	req := &a.request
+	a.model = strings.TrimPrefix(req.Model, "models/")
+	if a.model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	if err := checkUnsupportedOpenAIParams(req, "gemini"); err != nil {
+		return nil, err
+	}
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls {
+		return nil, unsupportedParamsError([]string{"parallel_tool_calls"}, "gemini")
+	}
+
+	out := geminiRequest{}
+
+	genConfig := &geminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		StopSequences:    parseOpenAIStop(req.Stop),
+		CandidateCount:   req.N,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Seed:             req.Seed,
+	}
+	if req.MaxCompletionTokens != nil {
+		genConfig.MaxOutputTokens = req.MaxCompletionTokens
+	} else {
+		genConfig.MaxOutputTokens = req.MaxTokens
+	}
+	if req.ResponseFormat != nil {
+		switch req.ResponseFormat.Type {
+		case "", "text":
+		case "json_object":
+			genConfig.ResponseMimeType = "application/json"
+		case "json_schema":
+			genConfig.ResponseMimeType = "application/json"
+			if req.ResponseFormat.JSONSchema != nil {
+				genConfig.ResponseJSONSchema = req.ResponseFormat.JSONSchema.Schema
+			}
+		default:
+			return nil, fmt.Errorf("unsupported response_format type: %s", req.ResponseFormat.Type)
+		}
+	}
+	if req.ReasoningEffort != "" {
+		budget, err := reasoningBudget(req.ReasoningEffort)
+		if err != nil {
+			return nil, err
+		}
+		genConfig.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: &budget}
+	}
+	out.GenerationConfig = genConfig
+
+	// Gemini identifies function responses by name, so remember the name of each tool call.
+	toolNames := make(map[string]string)
+	var systemParts []geminiPart
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			if text := openAIContentText(msg.Content); text != "" {
+				systemParts = append(systemParts, geminiPart{Text: text})
+			}
+		case "user":
+			parts, err := openAIPartsToGeminiParts(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			out.Contents = appendGeminiContent(out.Contents, "user", parts)
+		case "assistant":
+			parts, err := openAIPartsToGeminiParts(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			for _, call := range msg.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				args := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(args) || len(strings.TrimSpace(call.Function.Arguments)) == 0 {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+			out.Contents = appendGeminiContent(out.Contents, "model", parts)
+		case "tool":
+			name := toolNames[msg.ToolCallID]
+			if name == "" {
+				name = msg.Name
+			}
+			out.Contents = appendGeminiContent(out.Contents, "user", []geminiPart{{
+				FunctionResponse: &geminiFunctionResponse{
+					Name:     name,
+					Response: geminiFunctionResponsePayload(openAIContentText(msg.Content)),
+				},
+			}})
+		default:
+			return nil, fmt.Errorf("unsupported message role: %s", msg.Role)
+		}
+	}
+	if len(systemParts) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: systemParts}
+	}
+
+	var declarations []geminiFunctionDeclaration
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		declarations = append(declarations, geminiFunctionDeclaration{
+			Name:                 tool.Function.Name,
+			Description:          tool.Function.Description,
+			ParametersJSONSchema: tool.Function.Parameters,
+		})
+	}
+	if len(declarations) > 0 {
+		out.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+	out.ToolConfig = openAIToolChoiceToGemini(req.ToolChoice)
+
+	converted, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal generateContent request: %w", err)
+	}
+
+	result := &convertedRequest{
+		Body:     converted,
+		Path:     "/v1beta/models/" + a.model + ":generateContent",
+		Model:    a.model,
+		IsStream: req.Stream,
+	}
+	if req.Stream {
+		result.Path = "/v1beta/models/" + a.model + ":streamGenerateContent"
+		result.RawQuery = "alt=sse"
+	}
+	return result, nil
+}
+
+// openAIPartsToGeminiParts converts text and image parts into Gemini parts.
+func openAIPartsToGeminiParts(content json.RawMessage) ([]geminiPart, error) {
+	parts, err := parseOpenAIContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []geminiPart
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				result = append(result, geminiPart{Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				result = append(result, geminiPart{InlineData: &geminiBlob{MimeType: mediaType, Data: data}})
+			} else {
+				result = append(result, geminiPart{FileData: &geminiFileData{FileURI: part.ImageURL.URL}})
+			}
+		}
+	}
+	return result, nil
+}
+
+// appendGeminiContent merges consecutive contents of the same role.
+func appendGeminiContent(contents []geminiContent, role string, parts []geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiFunctionResponsePayload wraps a tool result, which Gemini requires to be a JSON object.
+func geminiFunctionResponsePayload(text string) json.RawMessage {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	payload, _ := json.Marshal(map[string]string{"content": text})
+	return payload
+}
+
+// openAIToolChoiceToGemini converts "auto"/"none"/"required" or a named function choice.
+func openAIToolChoiceToGemini(raw json.RawMessage) *geminiToolConfig {
+	if len(raw) == 0 {
+		return nil
+	}
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case "auto":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "AUTO"}}
+		case "required":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "ANY"}}
+		case "none":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "NONE"}}
+		}
+		return nil
+	}
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err == nil && named.Function.Name != "" {
+		return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{
+			Mode:                 "ANY",
+			AllowedFunctionNames: []string{named.Function.Name},
+		}}
+	}
+	return nil
+}
+
+// geminiPartsToOpenAIMessage converts candidate parts into a message, numbering tool calls from toolIndex.
+func geminiPartsToOpenAIMessage(parts []geminiPart, toolIndex int, withIndex bool) *openAIResponseMessage {
+	message := &openAIResponseMessage{}
+	var texts, thoughts []string
+	for _, part := range parts {
+		switch {
+		case part.FunctionCall != nil:
+			args := string(part.FunctionCall.Args)
+			if args == "" {
+				args = "{}"
+			}
+			call := openAIToolCall{
+				ID:       fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), toolIndex),
+				Type:     "function",
+				Function: openAIFunctionCall{Name: part.FunctionCall.Name, Arguments: args},
+			}
+			if withIndex {
+				index := toolIndex
+				call.Index = &index
+			}
+			toolIndex++
+			message.ToolCalls = append(message.ToolCalls, call)
+		case part.Thought:
+			thoughts = append(thoughts, part.Text)
+		case part.Text != "":
+			texts = append(texts, part.Text)
+		}
+	}
+	if len(texts) > 0 {
+		message.Content = stringPtr(strings.Join(texts, ""))
+	}
+	message.ReasoningContent = strings.Join(thoughts, "")
+	return message
+}
+
+func (a *openAIToGeminiAdapter) ConvertResponse(body []byte) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid generateContent response: %w", err)
+	}
+
+	choices := make([]openAIChoice, 0, len(resp.Candidates))
+	for i, candidate := range resp.Candidates {
+		message := geminiPartsToOpenAIMessage(candidate.Content.Parts, 0, false)
+		message.Role = "assistant"
+		if message.Content == nil && len(message.ToolCalls) == 0 {
+			message.Content = stringPtr("")
+		}
+		finishReason := geminiFinishReasonToOpenAI(candidate.FinishReason)
+		if len(message.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+		choices = append(choices, openAIChoice{Index: i, Message: message, FinishReason: &finishReason})
+	}
+
+	id := resp.ResponseID
+	if id == "" {
+		id = newOpenAIChatID()
+	}
+	model := resp.ModelVersion
+	if model == "" {
+		model = a.model
+	}
+
+	return json.Marshal(&openAIChatResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: choices,
+		Usage:   openAIUsageFrom(a.channelHandler.ExtractUsage(body)),
+	})
+}
+
+func (a *openAIToGeminiAdapter) ConvertError(statusCode int, body []byte) []byte {
+	return buildOpenAIError(statusCode, body)
+}
+
+func (a *openAIToGeminiAdapter) NewStreamConverter() streamConverter {
+	return &geminiToOpenAIStream{
+		adapter:      a,
+		id:           newOpenAIChatID(),
+		model:        a.model,
+		created:      time.Now().Unix(),
+		toolIndexes:  make(map[int]int),
+		includeUsage: a.request.StreamOptions != nil && a.request.StreamOptions.IncludeUsage,
+	}
+}
+
+// geminiToOpenAIStream converts streamGenerateContent chunks into chat.completion.chunk events.
+type geminiToOpenAIStream struct {
+	adapter      *openAIToGeminiAdapter
+	id           string
+	model        string
+	created      int64
+	started      bool
+	toolIndexes  map[int]int
+	usage        models.TokenUsage
+	includeUsage bool
+}
+
+func (s *geminiToOpenAIStream) Convert(event string, data []byte) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	s.usage.Merge(s.adapter.channelHandler.ExtractUsage(data))
+	if resp.ResponseID != "" {
+		s.id = resp.ResponseID
+	}
+	if resp.ModelVersion != "" {
+		s.model = resp.ModelVersion
+	}
+
+	var out []byte
+	if !s.started {
+		s.started = true
+		chunk, err := formatSSEJSON("", newOpenAIChunk(s.id, s.model, s.created, &openAIResponseMessage{Role: "assistant", Content: stringPtr("")}, nil))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+	}
+
+	for _, candidate := range resp.Candidates {
+		toolIndex := s.toolIndexes[candidate.Index]
+		delta := geminiPartsToOpenAIMessage(candidate.Content.Parts, toolIndex, true)
+		s.toolIndexes[candidate.Index] = toolIndex + len(delta.ToolCalls)
+
+		var finishReason *string
+		if candidate.FinishReason != "" {
+			reason := geminiFinishReasonToOpenAI(candidate.FinishReason)
+			if s.toolIndexes[candidate.Index] > 0 {
+				reason = "tool_calls"
+			}
+			finishReason = &reason
+		}
+		if delta.Content == nil && delta.ReasoningContent == "" && len(delta.ToolCalls) == 0 && finishReason == nil {
+			continue
+		}
+
+		chunk := newOpenAIChunk(s.id, s.model, s.created, delta, finishReason)
+		chunk.Choices[0].Index = candidate.Index
+		encoded, err := formatSSEJSON("", chunk)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, encoded...)
+	}
+
+	return out, nil
+}
+
+func (s *geminiToOpenAIStream) Finish() []byte {
+	var out []byte
+	if s.includeUsage {
+		usageChunk, err := formatSSEJSON("", &openAIChatResponse{
+			ID:      s.id,
+			Object:  "chat.completion.chunk",
+			Created: s.created,
+			Model:   s.model,
+			Choices: []openAIChoice{},
+			Usage:   openAIUsageFrom(&s.usage),
+		})
+		if err == nil {
+			out = append(out, usageChunk...)
+		}
+	}
+	return append(out, formatSSE("", []byte("[DONE]"))...)
+}
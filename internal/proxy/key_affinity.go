@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keyAffinityID identifies the conversation a request belongs to, so consecutive turns can be sent with the same key.
+// It uses the session header, then the OpenAI "user" field, then the leading bytes of the message array,
+// and returns an empty string when none of them is available.
+func keyAffinityID(c *gin.Context, group *models.Group, body []byte) string {
+	cfg := group.EffectiveConfig
+	if !cfg.KeyAffinityEnabled {
+		return ""
+	}
+
+	if cfg.KeyAffinityHeader != "" {
+		if session := c.GetHeader(cfg.KeyAffinityHeader); session != "" {
+			return hashAffinity("h:" + session)
+		}
+	}
+
+	var payload struct {
+		User     string          `json:"user"`
+		System   json.RawMessage `json:"system"`
+		Messages json.RawMessage `json:"messages"`
+		Contents json.RawMessage `json:"contents"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+
+	if payload.User != "" {
+		return hashAffinity("u:" + payload.User)
+	}
+
+	if cfg.KeyAffinityPrefixBytes > 0 {
+		// Anthropic keeps the system prompt outside the messages; it is part of the cached prefix.
+		prefix := append(append([]byte{}, payload.System...), payload.Messages...)
+		prefix = append(prefix, payload.Contents...)
+		if len(prefix) == 0 {
+			return ""
+		}
+		if len(prefix) > cfg.KeyAffinityPrefixBytes {
+			prefix = prefix[:cfg.KeyAffinityPrefixBytes]
+		}
+		return hashAffinity("p:" + string(prefix))
+	}
+
+	return ""
+}
+
+// hashAffinity keeps client-provided identifiers and prompts out of the store keys.
+func hashAffinity(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// checkModelAccess applies the group's model allow and deny lists and the rules of the client's proxy key
+// to the requested model and to the upstream model it resolves to, so that an alias or a fallback
+// cannot reach a model the rules deny. upstreamModel is empty when the model is sent unchanged.
+// A request that does not name a model, such as a multipart upload, is only allowed when no allow list applies,
+// except for read-only requests like listing models.
+func checkModelAccess(c *gin.Context, group *models.Group, model, upstreamModel string) error {
+	cfg := group.EffectiveConfig
+	rules := []utils.ModelAccessRule{{
+		Allow: utils.SplitAndTrim(cfg.ModelAllowlist, ","),
+		Deny:  utils.SplitAndTrim(cfg.ModelDenylist, ","),
+	}}
+	if cfg.ProxyKeyModelRules != "" {
+		keyRules, err := utils.ParseProxyKeyModelRules(cfg.ProxyKeyModelRules)
+		if err != nil {
+			logrus.Warnf("Ignoring invalid proxy key model rules of group %s: %v", group.Name, err)
+		} else if rule, ok := keyRules[c.GetString("proxyKey")]; ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	if model == "" {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			return nil
+		}
+		for _, rule := range rules {
+			if len(rule.Allow) > 0 {
+				return fmt.Errorf("requests that do not name a model are not allowed in group '%s'", group.Name)
+			}
+		}
+		return nil
+	}
+
+	for _, name := range []string{model, upstreamModel} {
+		if name == "" {
+			continue
+		}
+		if !rules[0].Permits(name) {
+			return fmt.Errorf("model '%s' is not allowed in group '%s'", name, group.Name)
+		}
+		for _, rule := range rules[1:] {
+			if !rule.Permits(name) {
+				return fmt.Errorf("model '%s' is not allowed for this proxy key", name)
+			}
+		}
+	}
+	return nil
+}
+
+// rejectModel answers a forbidden model with a 403 in the client's API format and records the rejection.
+func (ps *ProxyServer) rejectModel(c *gin.Context, pr *proxyRequest, err error) {
+	ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrForbidden, err.Error()))
+	ps.logRequest(c, pr, nil, http.StatusForbidden, 0, err, "", nil)
+}
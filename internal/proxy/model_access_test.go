@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckModelAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		settings      types.SystemSettings
+		proxyKey      string
+		method        string
+		model         string
+		upstreamModel string
+		wantErr       bool
+	}{
+		{
+			name:  "no rules",
+			model: "gpt-4o",
+		},
+		{
+			name:     "allowed by allow list",
+			settings: types.SystemSettings{ModelAllowlist: "gpt-4o*"},
+			model:    "gpt-4o-mini",
+		},
+		{
+			name:     "not in allow list",
+			settings: types.SystemSettings{ModelAllowlist: "gpt-4o*"},
+			model:    "o1",
+			wantErr:  true,
+		},
+		{
+			name:     "deny wins over allow",
+			settings: types.SystemSettings{ModelAllowlist: "*", ModelDenylist: "*opus*"},
+			model:    "claude-opus-4",
+			wantErr:  true,
+		},
+		{
+			name:          "alias to denied model",
+			settings:      types.SystemSettings{ModelDenylist: "*opus*"},
+			model:         "smart",
+			upstreamModel: "claude-opus-4",
+			wantErr:       true,
+		},
+		{
+			name:          "alias to model outside allow list",
+			settings:      types.SystemSettings{ModelAllowlist: "smart,claude-sonnet*"},
+			model:         "smart",
+			upstreamModel: "claude-opus-4",
+			wantErr:       true,
+		},
+		{
+			name:          "alias to allowed model",
+			settings:      types.SystemSettings{ModelAllowlist: "smart,claude-sonnet*"},
+			model:         "smart",
+			upstreamModel: "claude-sonnet-4",
+		},
+		{
+			name:          "proxy key denies alias target",
+			settings:      types.SystemSettings{ProxyKeyModelRules: `{"sk-cheap": {"deny": ["*opus*"]}}`},
+			proxyKey:      "sk-cheap",
+			model:         "smart",
+			upstreamModel: "claude-opus-4",
+			wantErr:       true,
+		},
+		{
+			name:     "proxy key rules of another key",
+			settings: types.SystemSettings{ProxyKeyModelRules: `{"sk-cheap": {"allow": ["gpt-4o-mini"]}}`},
+			proxyKey: "sk-full",
+			model:    "gpt-4o",
+		},
+		{
+			name: "no model without allow list",
+		},
+		{
+			name:     "no model with group allow list",
+			settings: types.SystemSettings{ModelAllowlist: "gpt-4o*"},
+			wantErr:  true,
+		},
+		{
+			name:     "no model with proxy key allow list",
+			settings: types.SystemSettings{ProxyKeyModelRules: `{"sk-cheap": {"allow": ["gpt-4o-mini"]}}`},
+			proxyKey: "sk-cheap",
+			wantErr:  true,
+		},
+		{
+			name:     "no model on read-only request",
+			settings: types.SystemSettings{ModelAllowlist: "gpt-4o*"},
+			method:   http.MethodGet,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(method, "/proxy/test/v1/chat/completions", nil)
+			if tt.proxyKey != "" {
+				c.Set("proxyKey", tt.proxyKey)
+			}
+			group := &models.Group{Name: "test", EffectiveConfig: tt.settings}
+
+			err := checkModelAccess(c, group, tt.model, tt.upstreamModel)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkModelAccess() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
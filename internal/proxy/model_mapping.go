@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelFieldPattern matches the model fields of OpenAI, Anthropic ("model") and Gemini ("modelVersion") payloads.
+// Escaped quotes inside string values never match, so generated content is left untouched.
+var modelFieldPattern = regexp.MustCompile(`("(?:model|modelVersion)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// restoreModel rewrites upstream model names in response data back to the model requested by the client.
+func (pr *proxyRequest) restoreModel(data []byte) []byte {
+	if pr.upstreamModel == "" || len(data) == 0 {
+		return data
+	}
+	quoted, _ := json.Marshal(pr.model)
+	replacement := "${1}" + strings.ReplaceAll(string(quoted), "$", "$$")
+	return modelFieldPattern.ReplaceAll(data, []byte(replacement))
+}
+
+// responseReader returns the upstream body, restoring the requested model name line by line when it was mapped.
+func (ps *ProxyServer) responseReader(c *gin.Context, resp *http.Response, pr *proxyRequest) io.Reader {
+	if pr.upstreamModel == "" {
+		return resp.Body
+	}
+	// The rewritten body may differ in length from the upstream one.
+	c.Writer.Header().Del("Content-Length")
+	return &modelRestoringReader{reader: bufio.NewReader(resp.Body), pr: pr}
+}
+
+// modelRestoringReader applies restoreModel to every line read from the upstream body.
+// Model fields never span lines, and SSE events are flushed at line boundaries anyway.
+type modelRestoringReader struct {
+	reader  *bufio.Reader
+	pr      *proxyRequest
+	pending []byte
+	err     error
+}
+
+func (r *modelRestoringReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.reader.ReadBytes('\n')
+		r.pending = r.pr.restoreModel(line)
+		r.err = err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// paramRuleMatches reports whether a rule applies to the request's model and path.
+// Both the requested model and the mapped upstream model are checked.
+func paramRuleMatches(rule models.ParamRule, modelNames []string, requestPath string) bool {
+	if len(rule.Paths) > 0 && !matchesAnyGlob(rule.Paths, requestPath) {
+		return false
+	}
+	if len(rule.Models) == 0 {
+		return true
+	}
+	for _, model := range modelNames {
+		if model != "" && matchesAnyGlob(rule.Models, model) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if utils.MatchGlob(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyParamRule applies one rule to a decoded request body.
+func applyParamRule(data map[string]any, rule models.ParamRule) {
+	segments := strings.Split(rule.Path, ".")
+	parent, ok := walkParamPath(data, segments[:len(segments)-1], rule.Action == models.ParamActionSet || rule.Action == models.ParamActionDefault)
+	if !ok {
+		return
+	}
+	last := segments[len(segments)-1]
+
+	current, exists := getParamChild(parent, last)
+	switch rule.Action {
+	case models.ParamActionSet:
+		setParamChild(parent, last, decodeParamValue(rule.Value))
+	case models.ParamActionDefault:
+		if !exists || current == nil {
+			setParamChild(parent, last, decodeParamValue(rule.Value))
+		}
+	case models.ParamActionDelete:
+		if obj, ok := parent.(map[string]any); ok {
+			delete(obj, last)
+		}
+	case models.ParamActionClamp:
+		if exists {
+			if clamped, ok := clampParamNumber(current, rule.Min, rule.Max); ok {
+				setParamChild(parent, last, clamped)
+			}
+		}
+	}
+}
+
+// walkParamPath descends to the container addressed by segments, creating missing objects when create is set.
+func walkParamPath(data map[string]any, segments []string, create bool) (any, bool) {
+	var node any = data
+	for _, segment := range segments {
+		child, exists := getParamChild(node, segment)
+		if !exists || child == nil {
+			obj, isObject := node.(map[string]any)
+			if !create || !isObject {
+				return nil, false
+			}
+			child = map[string]any{}
+			obj[segment] = child
+		}
+		switch child.(type) {
+		case map[string]any, []any:
+			node = child
+		default:
+			// A scalar is in the way; leave the body as the client sent it.
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func getParamChild(node any, segment string) (any, bool) {
+	switch v := node.(type) {
+	case map[string]any:
+		child, ok := v[segment]
+		return child, ok
+	case []any:
+		idx, err := strconv.Atoi(segment)
+		if err != nil || idx < 0 || idx >= len(v) {
+			return nil, false
+		}
+		return v[idx], true
+	}
+	return nil, false
+}
+
+func setParamChild(node any, segment string, value any) {
+	switch v := node.(type) {
+	case map[string]any:
+		v[segment] = value
+	case []any:
+		if idx, err := strconv.Atoi(segment); err == nil && idx >= 0 && idx < len(v) {
+			v[idx] = value
+		}
+	}
+}
+
+func decodeParamValue(raw json.RawMessage) any {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		logrus.Warnf("Invalid param rule value %s: %v", raw, err)
+		return nil
+	}
+	return value
+}
+
+// clampParamNumber limits a JSON number to the bounds, keeping integers as integers.
+func clampParamNumber(value any, minVal, maxVal *float64) (json.Number, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return "", false
+	}
+	f, err := number.Float64()
+	if err != nil {
+		return "", false
+	}
+	isInteger := !strings.ContainsAny(number.String(), ".eE")
+	clamped := f
+	if minVal != nil && clamped < *minVal {
+		clamped = *minVal
+		if isInteger {
+			clamped = math.Ceil(clamped)
+		}
+	}
+	if maxVal != nil && clamped > *maxVal {
+		clamped = *maxVal
+		if isInteger {
+			clamped = math.Floor(clamped)
+		}
+	}
+	if clamped == f {
+		return number, false
+	}
+	return json.Number(strconv.FormatFloat(clamped, 'f', -1, 64)), true
+}
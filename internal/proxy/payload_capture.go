@@ -0,0 +1,293 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// payloadCaptureContextKey stores the active capture of a request in the gin context.
+const payloadCaptureContextKey = "payloadCapture"
+
+const redactedPlaceholder = "[REDACTED]"
+
+// minBase64Length is the length from which an unbroken base64 string is treated as binary data.
+const minBase64Length = 256
+
+var base64Pattern = regexp.MustCompile(`^[A-Za-z0-9+/_\-\r\n]+=*$`)
+
+// payloadCapture records the request body and everything written to the client for the request log.
+// Server-sent events are reassembled into the generated text as they pass through.
+type payloadCapture struct {
+	gin.ResponseWriter
+	cfg         types.SystemSettings
+	requestBody string
+
+	limit    int
+	raw      bytes.Buffer
+	overflow bool
+
+	sseChecked bool
+	isSSE      bool
+	pending    []byte
+	text       strings.Builder
+}
+
+// startPayloadCapture starts capturing the payloads of a sampled request when capture is enabled for the group.
+func startPayloadCapture(c *gin.Context, group *models.Group, body *requestBody) {
+	cfg := group.EffectiveConfig
+	if !cfg.PayloadCaptureEnabled || rand.Intn(100) >= cfg.PayloadCaptureSampleRate {
+		return
+	}
+
+	pc := &payloadCapture{
+		ResponseWriter: c.Writer,
+		cfg:            cfg,
+		limit:          cfg.PayloadCaptureMaxSize << 10,
+	}
+	if body.isRaw() || !isBufferedContentType(c.GetHeader("Content-Type")) {
+		pc.requestBody = fmt.Sprintf("[%s body of %d bytes not captured]", c.GetHeader("Content-Type"), body.size)
+	} else {
+		pc.requestBody = string(body.bytes())
+	}
+
+	c.Writer = pc
+	c.Set(payloadCaptureContextKey, pc)
+}
+
+func (pc *payloadCapture) Write(p []byte) (int, error) {
+	n, err := pc.ResponseWriter.Write(p)
+	pc.observe(p[:n])
+	return n, err
+}
+
+func (pc *payloadCapture) WriteString(s string) (int, error) {
+	n, err := pc.ResponseWriter.WriteString(s)
+	pc.observe([]byte(s[:n]))
+	return n, err
+}
+
+func (pc *payloadCapture) observe(p []byte) {
+	if !pc.sseChecked {
+		pc.sseChecked = true
+		pc.isSSE = strings.Contains(pc.Header().Get("Content-Type"), "text/event-stream")
+	}
+
+	if !pc.overflow {
+		if room := pc.limit - pc.raw.Len(); len(p) > room {
+			pc.raw.Write(p[:room])
+			pc.overflow = true
+		} else {
+			pc.raw.Write(p)
+		}
+	}
+
+	if pc.isSSE {
+		pc.consumeLines(p)
+	}
+}
+
+// consumeLines appends the text carried by every complete "data:" line to the reassembled output.
+func (pc *payloadCapture) consumeLines(p []byte) {
+	pc.pending = append(pc.pending, p...)
+	for {
+		idx := bytes.IndexByte(pc.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimRight(pc.pending[:idx], "\r")
+		if data, ok := bytes.CutPrefix(line, []byte("data:")); ok && pc.text.Len() <= pc.limit {
+			pc.text.WriteString(streamEventText(bytes.TrimSpace(data)))
+		}
+		pc.pending = pc.pending[idx+1:]
+	}
+	if len(pc.pending) > maxUsageBufferSize {
+		pc.pending = nil
+	}
+}
+
+// streamEventText returns the generated text carried by an OpenAI, Anthropic or Gemini stream event.
+func streamEventText(data []byte) string {
+	if len(data) == 0 || data[0] != '{' {
+		return ""
+	}
+	var event struct {
+		Type    string          `json:"type"`
+		Delta   json.RawMessage `json:"delta"`
+		Choices []struct {
+			Text  string `json:"text"`
+			Delta struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	switch event.Type {
+	case "content_block_delta":
+		var delta struct {
+			Text        string `json:"text"`
+			Thinking    string `json:"thinking"`
+			PartialJSON string `json:"partial_json"`
+		}
+		if json.Unmarshal(event.Delta, &delta) == nil {
+			sb.WriteString(delta.Thinking + delta.Text + delta.PartialJSON)
+		}
+	case "response.output_text.delta":
+		var delta string
+		if json.Unmarshal(event.Delta, &delta) == nil {
+			sb.WriteString(delta)
+		}
+	}
+	for _, choice := range event.Choices {
+		sb.WriteString(choice.Delta.ReasoningContent + choice.Delta.Content + choice.Text)
+	}
+	for _, candidate := range event.Candidates {
+		for _, part := range candidate.Content.Parts {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+// payloadFromContext builds the redacted payload of a captured request, or returns nil when it was not captured.
+func payloadFromContext(c *gin.Context) *models.RequestPayload {
+	value, ok := c.Get(payloadCaptureContextKey)
+	if !ok {
+		return nil
+	}
+	pc := value.(*payloadCapture)
+
+	var maskPattern *regexp.Regexp
+	if pc.cfg.PayloadMaskPattern != "" {
+		var err error
+		if maskPattern, err = regexp.Compile(pc.cfg.PayloadMaskPattern); err != nil {
+			logrus.Warnf("Ignoring invalid payload mask pattern: %v", err)
+		}
+	}
+	redactor := payloadRedactor{
+		stripBase64: pc.cfg.PayloadStripBase64,
+		fields:      make(map[string]struct{}),
+		mask:        maskPattern,
+		limit:       pc.limit,
+	}
+	for _, field := range utils.SplitAndTrim(pc.cfg.PayloadRedactFields, ",") {
+		redactor.fields[strings.ToLower(field)] = struct{}{}
+	}
+
+	payload := &models.RequestPayload{}
+	payload.RequestBody, payload.RequestTruncated = redactor.apply([]byte(pc.requestBody))
+
+	response := pc.raw.Bytes()
+	if pc.isSSE && pc.text.Len() > 0 {
+		response = []byte(pc.text.String())
+	} else if encoding := pc.Header().Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		response = decodeCapturedBody(encoding, response)
+	}
+	payload.ResponseBody, payload.ResponseTruncated = redactor.apply(response)
+	payload.ResponseTruncated = payload.ResponseTruncated || (pc.overflow && !(pc.isSSE && pc.text.Len() > 0))
+
+	return payload
+}
+
+// decodeCapturedBody decompresses a gzip response captured as it was relayed to the client.
+func decodeCapturedBody(encoding string, body []byte) []byte {
+	if encoding == "gzip" {
+		if reader, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+			// A truncated capture still yields the part that could be decompressed.
+			decoded, _ := io.ReadAll(reader)
+			if len(decoded) > 0 {
+				return decoded
+			}
+		}
+	}
+	return []byte(fmt.Sprintf("[%s-encoded body of %d bytes not captured]", encoding, len(body)))
+}
+
+// payloadRedactor removes binary data and sensitive values from a captured body before it is stored.
+type payloadRedactor struct {
+	stripBase64 bool
+	fields      map[string]struct{}
+	mask        *regexp.Regexp
+	limit       int
+}
+
+// apply returns the redacted body, truncated to the size limit, and whether it was truncated.
+func (r payloadRedactor) apply(body []byte) (string, bool) {
+	if (r.stripBase64 || len(r.fields) > 0) && json.Valid(body) {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err == nil {
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(r.redactValue(value, "")); err == nil {
+				body = bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+			}
+		}
+	}
+
+	text := string(body)
+	if r.mask != nil {
+		text = r.mask.ReplaceAllString(text, redactedPlaceholder)
+	}
+	if len(text) <= r.limit {
+		return text, false
+	}
+	cut := r.limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut], true
+}
+
+func (r payloadRedactor) redactValue(value any, key string) any {
+	if _, ok := r.fields[strings.ToLower(key)]; ok && key != "" {
+		return redactedPlaceholder
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = r.redactValue(child, k)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = r.redactValue(child, "")
+		}
+	case string:
+		if r.stripBase64 {
+			if strings.HasPrefix(v, "data:") && strings.Contains(v, ";base64,") {
+				return fmt.Sprintf("[data URI of %d bytes omitted]", len(v))
+			}
+			if len(v) >= minBase64Length && base64Pattern.MatchString(v) {
+				return fmt.Sprintf("[base64 data of %d bytes omitted]", len(v))
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"gpt-load/internal/channel"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Plugin is a step of a group's transformation pipeline.
+// A plugin takes part in a stage of the request by also implementing RequestHook, UpstreamHook or ResponseHook.
+type Plugin interface {
+	Name() string
+}
+
+// RequestHook rewrites the request once, after format translation and before a key is selected.
+type RequestHook interface {
+	Plugin
+	BeforeRequest(pc *PluginContext) error
+}
+
+// UpstreamHook adjusts the upstream HTTP request of every attempt, after the key is known.
+type UpstreamHook interface {
+	Plugin
+	BeforeSend(pc *PluginContext, req *http.Request, apiKey *models.APIKey) error
+}
+
+// ResponseHook rewrites a complete non-stream response body before it is sent to the client.
+// Streamed responses are relayed as they arrive and do not pass through response hooks.
+type ResponseHook interface {
+	Plugin
+	AfterResponse(pc *PluginContext, statusCode int, body []byte) ([]byte, error)
+}
+
+// PluginContext is the request state shared by the plugins of a pipeline.
+type PluginContext struct {
+	Gin     *gin.Context
+	Group   *models.Group
+	Channel channel.ChannelProxy
+
+	// RequestURL is the upstream path and query. Plugins may replace it.
+	RequestURL *url.URL
+	// Model is the model requested by the client.
+	Model string
+	// UpstreamModel is the model sent upstream when a plugin replaced it; the client still sees Model.
+	UpstreamModel string
+	// Body is the request body in the channel's native format. It is nil for spooled and streamed bodies.
+	Body     []byte
+	IsStream bool
+}
+
+// PluginFactory creates a plugin from its configuration in a group.
+type PluginFactory func(config json.RawMessage) (Plugin, error)
+
+var (
+	// pluginRegistry holds the mapping from plugin name to its factory.
+	pluginRegistry = make(map[string]PluginFactory)
+)
+
+// RegisterPlugin adds a plugin factory to the registry. Call it from an init function.
+func RegisterPlugin(name string, factory PluginFactory) {
+	if _, exists := pluginRegistry[name]; exists {
+		panic(fmt.Sprintf("plugin '%s' is already registered", name))
+	}
+	pluginRegistry[name] = factory
+}
+
+// GetPlugins returns the sorted names of all registered plugins.
+func GetPlugins() []string {
+	names := make([]string, 0, len(pluginRegistry))
+	for name := range pluginRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultPlugins are the built-in steps in their default processing order.
+// They always run; a group's plugin list only decides where they run by listing them.
+var defaultPlugins = []models.PluginConfig{
+	{Name: "model_mapping"},
+	{Name: "param_overrides"},
+	{Name: "header_rules"},
+}
+
+// withBuiltinPlugins returns the effective pipeline configuration of a group.
+// Built-in steps that the list does not place explicitly run first, in their default order.
+func withBuiltinPlugins(configs []models.PluginConfig) []models.PluginConfig {
+	listed := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		listed[cfg.Name] = true
+	}
+	effective := make([]models.PluginConfig, 0, len(defaultPlugins)+len(configs))
+	for _, builtin := range defaultPlugins {
+		if !listed[builtin.Name] {
+			effective = append(effective, builtin)
+		}
+	}
+	return append(effective, configs...)
+}
+
+// ValidatePlugins checks that every plugin exists and accepts its configuration.
+func ValidatePlugins(configs []models.PluginConfig) error {
+	_, err := buildPipeline(configs)
+	return err
+}
+
+// pluginPipeline runs the plugins of a group in their configured order.
+type pluginPipeline []Plugin
+
+func buildPipeline(configs []models.PluginConfig) (pluginPipeline, error) {
+	pipeline := make(pluginPipeline, 0, len(configs))
+	for i, cfg := range configs {
+		factory, ok := pluginRegistry[cfg.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown plugin '%s' at position %d. Available plugins are: %v", cfg.Name, i+1, GetPlugins())
+		}
+		plugin, err := factory(cfg.Config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config for plugin '%s' at position %d: %w", cfg.Name, i+1, err)
+		}
+		pipeline = append(pipeline, plugin)
+	}
+	return pipeline, nil
+}
+
+func (p pluginPipeline) beforeRequest(pc *PluginContext) error {
+	for _, plugin := range p {
+		if hook, ok := plugin.(RequestHook); ok {
+			if err := hook.BeforeRequest(pc); err != nil {
+				return fmt.Errorf("plugin %s: %w", plugin.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// requestHookError returns the client error for a failed BeforeRequest hook.
+// Hooks may reject a request with their own APIError; other errors are reported as a bad request.
+func requestHookError(err error) *app_errors.APIError {
+	var apiErr *app_errors.APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = app_errors.NewAPIError(app_errors.ErrBadRequest, fmt.Sprintf("Failed to transform request: %v", err))
+	}
+	return apiErr
+}
+
+func (p pluginPipeline) beforeSend(pc *PluginContext, req *http.Request, apiKey *models.APIKey) error {
+	for _, plugin := range p {
+		if hook, ok := plugin.(UpstreamHook); ok {
+			if err := hook.BeforeSend(pc, req, apiKey); err != nil {
+				return fmt.Errorf("plugin %s: %w", plugin.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p pluginPipeline) afterResponse(pc *PluginContext, statusCode int, body []byte) ([]byte, error) {
+	for _, plugin := range p {
+		if hook, ok := plugin.(ResponseHook); ok {
+			var err error
+			if body, err = hook.AfterResponse(pc, statusCode, body); err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", plugin.Name(), err)
+			}
+		}
+	}
+	return body, nil
+}
+
+// hasResponseHooks reports whether responses must be buffered to run the pipeline on them.
+func (p pluginPipeline) hasResponseHooks() bool {
+	for _, plugin := range p {
+		if _, ok := plugin.(ResponseHook); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pipelineCache keeps the built pipeline of each group until the group is reloaded.
+type pipelineCache struct {
+	mu      sync.Mutex
+	entries map[uint]pipelineCacheEntry
+}
+
+type pipelineCacheEntry struct {
+	group    *models.Group
+	pipeline pluginPipeline
+}
+
+// pipelineFor returns the pipeline of a group. Groups are replaced as a whole on reload, so a different
+// group pointer means the configuration may have changed.
+func (ps *ProxyServer) pipelineFor(group *models.Group) (pluginPipeline, error) {
+	ps.pipelines.mu.Lock()
+	defer ps.pipelines.mu.Unlock()
+
+	if entry, ok := ps.pipelines.entries[group.ID]; ok && entry.group == group {
+		return entry.pipeline, nil
+	}
+
+	pipeline, err := buildPipeline(withBuiltinPlugins(group.PluginList))
+	if err != nil {
+		return nil, err
+	}
+	if ps.pipelines.entries == nil {
+		ps.pipelines.entries = make(map[uint]pipelineCacheEntry)
+	}
+	ps.pipelines.entries[group.ID] = pipelineCacheEntry{group: group, pipeline: pipeline}
+	return pipeline, nil
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterPlugin("model_mapping", withoutConfig(modelMappingPlugin{}))
+	RegisterPlugin("param_overrides", withoutConfig(paramOverridesPlugin{}))
+	RegisterPlugin("header_rules", withoutConfig(headerRulesPlugin{}))
+}
+
+// withoutConfig returns the factory of a plugin that is configured through the group's own settings.
+func withoutConfig(plugin Plugin) PluginFactory {
+	return func(config json.RawMessage) (Plugin, error) {
+		if trimmed := bytes.TrimSpace(config); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) && !bytes.Equal(trimmed, []byte("{}")) {
+			return nil, fmt.Errorf("plugin '%s' takes no config; it uses the group settings", plugin.Name())
+		}
+		return plugin, nil
+	}
+}
+
+// decodePluginConfig decodes a plugin configuration, rejecting unknown fields.
+func decodePluginConfig(config json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(config)) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(config))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// modelMappingPlugin resolves a group model alias and rewrites the request for the upstream.
+type modelMappingPlugin struct{}
+
+func (modelMappingPlugin) Name() string { return "model_mapping" }
+
+func (modelMappingPlugin) BeforeRequest(pc *PluginContext) error {
+	model := pc.Model
+	if pc.UpstreamModel != "" {
+		model = pc.UpstreamModel
+	}
+	resolved, ok := pc.Group.ModelMappingMap[model]
+	if !ok || resolved == model {
+		return nil
+	}
+
+	requestURL, rewritten, err := pc.Channel.RewriteModel(pc.RequestURL, pc.Body, resolved)
+	if err != nil {
+		return fmt.Errorf("failed to apply model mapping: %w", err)
+	}
+	pc.RequestURL = requestURL
+	pc.UpstreamModel = resolved
+	pc.Body = rewritten
+	return nil
+}
+
+// paramOverridesPlugin sets the group's top-level parameter overrides on JSON request bodies,
+// then applies its param rules in order.
+type paramOverridesPlugin struct{}
+
+func (paramOverridesPlugin) Name() string { return "param_overrides" }
+
+func (paramOverridesPlugin) BeforeRequest(pc *PluginContext) error {
+	group := pc.Group
+	if (len(group.ParamOverrides) == 0 && len(group.ParamRuleList) == 0) || len(pc.Body) == 0 {
+		return nil
+	}
+
+	requestData, ok := decodeJSONBody(pc.Body)
+	if !ok {
+		logrus.Warnf("failed to unmarshal request body for param override, passing through")
+		return nil
+	}
+
+	for key, value := range group.ParamOverrides {
+		requestData[key] = value
+	}
+
+	modelNames := []string{pc.Model, pc.UpstreamModel}
+	requestPath := strings.TrimPrefix(pc.RequestURL.Path, "/proxy/"+group.Name)
+	for _, rule := range group.ParamRuleList {
+		if paramRuleMatches(rule, modelNames, requestPath) {
+			applyParamRule(requestData, rule)
+		}
+	}
+
+	body, err := json.Marshal(requestData)
+	if err != nil {
+		return err
+	}
+	pc.Body = body
+	return nil
+}
+
+// headerRulesPlugin applies the group's header rules to every upstream attempt.
+type headerRulesPlugin struct{}
+
+func (headerRulesPlugin) Name() string { return "header_rules" }
+
+func (headerRulesPlugin) BeforeSend(pc *PluginContext, req *http.Request, apiKey *models.APIKey) error {
+	if len(pc.Group.HeaderRuleList) > 0 {
+		headerCtx := utils.NewHeaderVariableContextFromGin(pc.Gin, pc.Group, apiKey)
+		headerCtx.Model = pc.Model
+		if pc.UpstreamModel != "" {
+			headerCtx.Model = pc.UpstreamModel
+		}
+		utils.ApplyHeaderRules(req, pc.Group.HeaderRuleList, headerCtx)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterPlugin("pii_mask", newPIIMaskPlugin)
+	RegisterPlugin("prompt_prefix", newPromptPrefixPlugin)
+}
+
+// decodeJSONBody decodes a JSON request body, keeping numbers as they were written.
+func decodeJSONBody(body []byte) (map[string]any, bool) {
+	if len(body) == 0 {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var data map[string]any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// piiPatterns are the built-in kinds of personal data the pii_mask plugin recognizes.
+var piiPatterns = map[string]*regexp.Regexp{
+	"email":       regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	"phone":       regexp.MustCompile(`(?:\+\d{1,3}[\s-]?)?\(?\d{3}\)?[\s.-]?\d{3}[\s.-]?\d{4}\b`),
+	"credit_card": regexp.MustCompile(`\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{1,4}\b`),
+	"ipv4":        regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+}
+
+// piiMaskPlugin replaces personal data in the text of a request before it leaves the gateway.
+type piiMaskPlugin struct {
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+func newPIIMaskPlugin(config json.RawMessage) (Plugin, error) {
+	var cfg struct {
+		Types       []string `json:"types"`
+		Patterns    []string `json:"patterns"`
+		Replacement string   `json:"replacement"`
+	}
+	if err := decodePluginConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Types) == 0 && len(cfg.Patterns) == 0 {
+		cfg.Types = []string{"email", "phone", "credit_card"}
+	}
+
+	p := &piiMaskPlugin{replacement: cfg.Replacement}
+	if p.replacement == "" {
+		p.replacement = "[PII]"
+	}
+	for _, kind := range cfg.Types {
+		pattern, ok := piiPatterns[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown PII type '%s'; supported types are email, phone, credit_card and ipv4", kind)
+		}
+		p.patterns = append(p.patterns, pattern)
+	}
+	for _, expr := range cfg.Patterns {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", expr, err)
+		}
+		p.patterns = append(p.patterns, pattern)
+	}
+	return p, nil
+}
+
+func (p *piiMaskPlugin) Name() string { return "pii_mask" }
+
+func (p *piiMaskPlugin) BeforeRequest(pc *PluginContext) error {
+	data, ok := decodeJSONBody(pc.Body)
+	if !ok {
+		return nil
+	}
+	body, err := json.Marshal(p.maskValue(data, ""))
+	if err != nil {
+		return err
+	}
+	pc.Body = body
+	return nil
+}
+
+// piiTextFields are the fields that carry message text in the supported API formats, such as
+// OpenAI "content", Anthropic "text" and "system" and Gemini "parts[].text". Other strings, like IDs,
+// tool schemas and base64 media, are never masked.
+var piiTextFields = map[string]bool{
+	"content": true,
+	"text":    true,
+	"system":  true,
+}
+
+func (p *piiMaskPlugin) maskValue(value any, key string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = p.maskValue(child, k)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = p.maskValue(child, key)
+		}
+	case string:
+		if !piiTextFields[key] || strings.HasPrefix(v, "data:") {
+			return v
+		}
+		for _, pattern := range p.patterns {
+			v = pattern.ReplaceAllString(v, p.replacement)
+		}
+		return v
+	}
+	return value
+}
+
+// promptPrefixPlugin puts a fixed instruction in front of the system prompt of chat requests.
+type promptPrefixPlugin struct {
+	text string
+}
+
+func newPromptPrefixPlugin(config json.RawMessage) (Plugin, error) {
+	var cfg struct {
+		Text string `json:"text"`
+	}
+	if err := decodePluginConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(cfg.Text) == "" {
+		return nil, errors.New("text is required")
+	}
+	return &promptPrefixPlugin{text: cfg.Text}, nil
+}
+
+func (p *promptPrefixPlugin) Name() string { return "prompt_prefix" }
+
+func (p *promptPrefixPlugin) BeforeRequest(pc *PluginContext) error {
+	data, ok := decodeJSONBody(pc.Body)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case data["contents"] != nil:
+		p.prefixGemini(data)
+	case data["messages"] != nil && pc.Group.ChannelType == "anthropic":
+		data["system"] = p.prefixAnthropic(data["system"])
+	case data["messages"] != nil:
+		data["messages"] = p.prefixOpenAI(data["messages"])
+	case data["input"] != nil:
+		// OpenAI Responses API
+		data["instructions"] = p.prefixText(data["instructions"])
+	default:
+		return nil
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	pc.Body = body
+	return nil
+}
+
+func (p *promptPrefixPlugin) prefixText(existing any) string {
+	if text, ok := existing.(string); ok && text != "" {
+		return p.text + "\n\n" + text
+	}
+	return p.text
+}
+
+func (p *promptPrefixPlugin) prefixOpenAI(messages any) any {
+	list, ok := messages.([]any)
+	if !ok {
+		return messages
+	}
+	if len(list) > 0 {
+		if first, ok := list[0].(map[string]any); ok && (first["role"] == "system" || first["role"] == "developer") {
+			if _, isText := first["content"].(string); isText {
+				first["content"] = p.prefixText(first["content"])
+				return list
+			}
+		}
+	}
+	return append([]any{map[string]any{"role": "system", "content": p.text}}, list...)
+}
+
+func (p *promptPrefixPlugin) prefixAnthropic(system any) any {
+	if blocks, ok := system.([]any); ok {
+		return append([]any{map[string]any{"type": "text", "text": p.text}}, blocks...)
+	}
+	return p.prefixText(system)
+}
+
+func (p *promptPrefixPlugin) prefixGemini(data map[string]any) {
+	key := "systemInstruction"
+	if _, ok := data["system_instruction"]; ok {
+		key = "system_instruction"
+	}
+	instruction, _ := data[key].(map[string]any)
+	if instruction == nil {
+		instruction = map[string]any{}
+	}
+	parts, _ := instruction["parts"].([]any)
+	instruction["parts"] = append([]any{map[string]any{"text": p.text}}, parts...)
+	data[key] = instruction
+}
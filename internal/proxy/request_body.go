@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// errBodyAlreadySent is returned when a passthrough body is requested for a second attempt.
+var errBodyAlreadySent = errors.New("request body was streamed to the upstream and cannot be resent")
+
+// requestBody holds the client request body.
+// JSON bodies are kept in memory so they can be inspected and rewritten. Other bodies, such as file uploads and audio,
+// are kept in memory when small, spooled to a temporary file when large, or streamed straight through when they are
+// only sent once.
+type requestBody struct {
+	data   []byte
+	file   *os.File
+	stream io.ReadCloser
+	size   int64 // -1 when unknown
+}
+
+// isBufferedContentType reports whether a body of this type must be read into memory for model extraction,
+// format translation and parameter overrides.
+func isBufferedContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// readRequestBody reads the client body according to the group's size limit and spooling threshold.
+// canStream tells whether the request is sent at most once, so a large body can be streamed through.
+func readRequestBody(c *gin.Context, group *models.Group, canStream bool) (*requestBody, error) {
+	cfg := group.EffectiveConfig
+	body := c.Request.Body
+	if maxSize := int64(cfg.MaxRequestBodySize) << 20; maxSize > 0 {
+		if c.Request.ContentLength > maxSize {
+			return nil, &http.MaxBytesError{Limit: maxSize}
+		}
+		body = http.MaxBytesReader(c.Writer, body, maxSize)
+	}
+
+	if isBufferedContentType(c.GetHeader("Content-Type")) {
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		return &requestBody{data: data, size: int64(len(data))}, nil
+	}
+
+	threshold := int64(cfg.RequestBodySpoolThreshold) << 10
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength <= threshold {
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		return &requestBody{data: data, size: int64(len(data))}, nil
+	}
+
+	if canStream {
+		return &requestBody{stream: body, size: c.Request.ContentLength}, nil
+	}
+	defer body.Close()
+
+	// Read up to the threshold first; only bodies that turn out to be larger touch the disk.
+	head, err := io.ReadAll(io.LimitReader(body, threshold+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(head)) <= threshold {
+		return &requestBody{data: head, size: int64(len(head))}, nil
+	}
+
+	file, err := os.CreateTemp("", "gpt-load-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for request body: %w", err)
+	}
+	size, err := io.Copy(file, io.MultiReader(bytes.NewReader(head), body))
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &requestBody{file: file, size: size}, nil
+}
+
+// bytes returns the in-memory body, or nil for a spooled or streamed body.
+func (b *requestBody) bytes() []byte {
+	return b.data
+}
+
+// isRaw reports whether the body is spooled or streamed rather than held in memory.
+func (b *requestBody) isRaw() bool {
+	return b.file != nil || b.stream != nil
+}
+
+// reader returns a reader over the whole body for one upstream attempt, and the body length or -1 if unknown.
+func (b *requestBody) reader() (io.Reader, int64, error) {
+	switch {
+	case b.file != nil:
+		return io.NewSectionReader(b.file, 0, b.size), b.size, nil
+	case b.stream != nil:
+		stream := b.stream
+		if stream == http.NoBody {
+			return nil, 0, errBodyAlreadySent
+		}
+		b.stream = http.NoBody
+		return stream, b.size, nil
+	default:
+		return bytes.NewReader(b.data), b.size, nil
+	}
+}
+
+// Close releases an unsent passthrough body and the temporary file of a spooled body.
+func (b *requestBody) Close() {
+	if b.stream != nil {
+		b.stream.Close()
+	}
+	if b.file != nil {
+		b.file.Close()
+		if err := os.Remove(b.file.Name()); err != nil {
+			logrus.Warnf("Failed to remove spooled request body %s: %v", b.file.Name(), err)
+		}
+	}
+}
+
+// requestTooLargeError returns the 413 error for a body that exceeded the size limit, or nil for other errors.
+func requestTooLargeError(err error) *app_errors.APIError {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return nil
+	}
+	return app_errors.NewAPIError(app_errors.ErrRequestTooLarge, fmt.Sprintf("Request body exceeds the limit of %d MB", maxBytesErr.Limit>>20))
+}
+
+// bodyReader returns the body to send for one upstream attempt and its length, or -1 if unknown.
+func (pr *proxyRequest) bodyReader() (io.Reader, int64, error) {
+	if pr.rawBody != nil {
+		return pr.rawBody.reader()
+	}
+	return bytes.NewReader(pr.bodyBytes), int64(len(pr.bodyBytes)), nil
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// resourceCaptureLimit bounds the creation response buffered to read the new object's ID.
+const resourceCaptureLimit = 256 * 1024
+
+// statefulResourceSegments are the endpoints whose objects only exist under the key that created them.
+var statefulResourceSegments = map[string]bool{
+	"files":         true,
+	"batches":       true,
+	"assistants":    true,
+	"threads":       true,
+	"vector_stores": true,
+}
+
+// resourceIDPattern matches the IDs of files, batches, assistants, threads and vector stores.
+var resourceIDPattern = regexp.MustCompile(`^(file-|file_|batch_|msgbatch_|asst_|thread_|vs_)[A-Za-z0-9_-]+$`)
+
+// isStatefulResourcePath reports whether a request path addresses a stateful endpoint.
+func isStatefulResourcePath(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if statefulResourceSegments[segment] {
+			return true
+		}
+	}
+	return false
+}
+
+// referencedResourceIDs collects the object IDs a request refers to, from its path and from *_id or *_ids body fields,
+// for example input_file_id of a batch or assistant_id of a run.
+func referencedResourceIDs(path string, body []byte) []string {
+	var ids []string
+	for _, segment := range strings.Split(path, "/") {
+		if resourceIDPattern.MatchString(segment) {
+			ids = append(ids, segment)
+		}
+	}
+
+	if !bytes.Contains(body, []byte(`_id"`)) && !bytes.Contains(body, []byte(`_ids"`)) {
+		return ids
+	}
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ids
+	}
+	return collectResourceIDs(payload, "", ids)
+}
+
+func collectResourceIDs(value any, key string, ids []string) []string {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			ids = collectResourceIDs(child, k, ids)
+		}
+	case []any:
+		for _, child := range v {
+			ids = collectResourceIDs(child, key, ids)
+		}
+	case string:
+		if (strings.HasSuffix(key, "_id") || strings.HasSuffix(key, "_ids")) && resourceIDPattern.MatchString(v) {
+			ids = append(ids, v)
+		}
+	}
+	return ids
+}
+
+// selectKey returns the key that created an object referenced by the request, or selects one as usual.
+func (ps *ProxyServer) selectKey(group *models.Group, pr *proxyRequest) (*models.APIKey, error) {
+	if len(pr.resourceIDs) > 0 {
+		apiKey, err := ps.keyProvider.SelectResourceKey(group, pr.resourceIDs)
+		if err != nil {
+			logrus.Warnf("Failed to look up the owner of resources %v in group %s: %v", pr.resourceIDs, group.Name, err)
+		} else if apiKey != nil {
+			return apiKey, nil
+		}
+	}
+	return ps.keyProvider.SelectKey(group, pr.affinityKey)
+}
+
+// preferResourceOwner moves the member group that created a referenced object to the front of an aggregate's members.
+func (ps *ProxyServer) preferResourceOwner(members []*models.Group, resourceIDs []string) []*models.Group {
+	if len(resourceIDs) == 0 {
+		return members
+	}
+	groupID, _, ok := ps.keyProvider.ResourceOwner(resourceIDs)
+	if !ok {
+		return members
+	}
+	for i, member := range members {
+		if member.ID == groupID {
+			ordered := append([]*models.Group{member}, members[:i]...)
+			return append(ordered, members[i+1:]...)
+		}
+	}
+	return members
+}
+
+// prepareResourceCapture starts capturing a creation response to record the owner of the new object.
+func (pr *proxyRequest) prepareResourceCapture(c *gin.Context, statusCode int) {
+	if c.Request.Method != http.MethodPost || pr.isStream || !isStatefulResourcePath(pr.requestURL.Path) {
+		return
+	}
+	if statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices {
+		pr.resourceCapture = newResponseCapture(resourceCaptureLimit)
+	}
+}
+
+// trackResources records the key that created an object and forgets the owner of a deleted one.
+func (ps *ProxyServer) trackResources(c *gin.Context, pr *proxyRequest, apiKey *models.APIKey) {
+	statusCode := c.Writer.Status()
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return
+	}
+
+	if c.Request.Method == http.MethodDelete {
+		segments := strings.Split(strings.TrimRight(pr.requestURL.Path, "/"), "/")
+		if last := segments[len(segments)-1]; resourceIDPattern.MatchString(last) && isStatefulResourcePath(pr.requestURL.Path) {
+			ps.keyProvider.UnbindResource(last)
+		}
+		return
+	}
+
+	if pr.resourceCapture == nil || pr.resourceCapture.overflow {
+		return
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(pr.resourceCapture.buf.Bytes(), &created); err != nil {
+		return
+	}
+	if resourceIDPattern.MatchString(created.ID) {
+		ps.keyProvider.BindResource(created.ID, apiKey)
+	}
+}
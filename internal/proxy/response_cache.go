@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gpt-load/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// cachedResponse is the stored form of a response served from the response cache.
+type cachedResponse struct {
+	StatusCode      int    `json:"status_code"`
+	ContentType     string `json:"content_type"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	Body            []byte `json:"body"`
+}
+
+// responseCacheKeyHeaders are the request headers that change the response for the same body,
+// such as the API version, beta features and the negotiated encoding.
+var responseCacheKeyHeaders = []string{"anthropic-version", "anthropic-beta", "Accept", "Accept-Encoding"}
+
+// responseCapture buffers the response body written to the client, up to a size limit.
+type responseCapture struct {
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func newResponseCapture(limit int) *responseCapture {
+	return &responseCapture{limit: limit}
+}
+
+func (rc *responseCapture) Write(p []byte) (int, error) {
+	if rc.overflow {
+		return len(p), nil
+	}
+	if rc.buf.Len()+len(p) > rc.limit {
+		rc.overflow = true
+		rc.buf.Reset()
+		return len(p), nil
+	}
+	return rc.buf.Write(p)
+}
+
+// isCacheBypassed reports whether the client asked not to use the response cache.
+func isCacheBypassed(c *gin.Context) bool {
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	return strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store")
+}
+
+// responseCacheKey builds the cache key for a client request from the group, method, path,
+// the headers in responseCacheKeyHeaders and the normalized body.
+// The key is computed from what the client sent, so it also covers translated and model-mapped requests.
+func responseCacheKey(c *gin.Context, pr *proxyRequest, bodyBytes []byte) string {
+	query := c.Request.URL.Query()
+	query.Del("key")
+
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Request.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(query.Encode()))
+	h.Write([]byte{0})
+	for _, header := range responseCacheKeyHeaders {
+		h.Write([]byte(strings.Join(c.Request.Header.Values(header), ",")))
+		h.Write([]byte{0})
+	}
+	h.Write(normalizeJSONBody(bodyBytes))
+
+	return fmt.Sprintf("response_cache:%d:%s", pr.group.ID, hex.EncodeToString(h.Sum(nil)))
+}
+
+// normalizeJSONBody re-encodes a JSON body so that key order and whitespace do not affect the cache key.
+// Non-JSON bodies are used as is.
+func normalizeJSONBody(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return body
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return normalized
+}
+
+// serveCachedResponse writes the cached response for the request if there is one.
+func (ps *ProxyServer) serveCachedResponse(c *gin.Context, pr *proxyRequest) bool {
+	data, err := ps.store.Get(pr.cacheKey)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			logrus.Warnf("Failed to read response cache for group %s: %v", pr.group.Name, err)
+		}
+		return false
+	}
+
+	var cached cachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		logrus.Warnf("Discarding invalid response cache entry for group %s: %v", pr.group.Name, err)
+		return false
+	}
+
+	c.Header("X-Cache", "HIT")
+	if cached.ContentEncoding != "" {
+		c.Header("Content-Encoding", cached.ContentEncoding)
+	}
+	c.Data(cached.StatusCode, cached.ContentType, cached.Body)
+
+	pr.cacheHit = true
+	ps.logRequest(c, pr, nil, cached.StatusCode, 0, nil, "", nil)
+	return true
+}
+
+// storeCachedResponse saves the captured response body once it has been sent to the client.
+func (ps *ProxyServer) storeCachedResponse(c *gin.Context, pr *proxyRequest) {
+	statusCode := c.Writer.Status()
+	if pr.cacheCapture == nil || pr.cacheCapture.overflow || statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return
+	}
+
+	data, err := json.Marshal(cachedResponse{
+		StatusCode:      statusCode,
+		ContentType:     c.Writer.Header().Get("Content-Type"),
+		ContentEncoding: c.Writer.Header().Get("Content-Encoding"),
+		Body:            pr.cacheCapture.buf.Bytes(),
+	})
+	if err != nil {
+		logrus.Warnf("Failed to encode response cache entry for group %s: %v", pr.group.Name, err)
+		return
+	}
+
+	ttl := time.Duration(pr.group.EffectiveConfig.ResponseCacheTTLSeconds) * time.Second
+	if err := ps.store.Set(pr.cacheKey, data, ttl); err != nil {
+		logrus.Warnf("Failed to write response cache for group %s: %v", pr.group.Name, err)
+	}
+}
+
+// prepareResponseCapture starts capturing the response body for a cacheable request.
+func (pr *proxyRequest) prepareResponseCapture(c *gin.Context, statusCode int) {
+	if pr.cacheKey == "" {
+		return
+	}
+	c.Header("X-Cache", "MISS")
+	if statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices {
+		pr.cacheCapture = newResponseCapture(pr.group.EffectiveConfig.ResponseCacheMaxBodySize * 1024)
+	}
+}
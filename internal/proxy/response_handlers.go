@@ -1,14 +1,19 @@
 package proxy
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"net/http"
 
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Response) {
+func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Response, pr *proxyRequest) *models.TokenUsage {
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
@@ -17,32 +22,220 @@ func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Respon
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
 		logrus.Error("Streaming unsupported by the writer, falling back to normal response")
-		ps.handleNormalResponse(c, resp)
-		return
+		return ps.handleNormalResponse(c, resp, pr)
+	}
+
+	collector := newUsageCollector(pr.channelHandler, resp)
+	body := ps.responseReader(c, resp, pr)
+	var filter *usageChunkFilter
+	if pr.stripUsageChunk {
+		filter = &usageChunkFilter{}
 	}
 
 	buf := make([]byte, 4*1024)
 	for {
-		n, err := resp.Body.Read(buf)
+		n, err := body.Read(buf)
 		if n > 0 {
-			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
-				logUpstreamError("writing stream to client", writeErr)
-				return
+			// The collector sees the stream as sent by the upstream, including a usage chunk the client does not get.
+			if collector != nil {
+				collector.Write(buf[:n])
+			}
+			out := buf[:n]
+			if filter != nil {
+				out = filter.Filter(out)
+			}
+			if len(out) > 0 {
+				if _, writeErr := c.Writer.Write(out); writeErr != nil {
+					logUpstreamError("writing stream to client", writeErr)
+					return collector.Result()
+				}
+				flusher.Flush()
 			}
-			flusher.Flush()
 		}
 		if err == io.EOF {
+			if filter != nil {
+				if rest := filter.Flush(); len(rest) > 0 {
+					c.Writer.Write(rest)
+					flusher.Flush()
+				}
+			}
 			break
 		}
 		if err != nil {
+			if errors.Is(err, errStreamIdleTimeout) {
+				logrus.Warnf("Stream for group %s stalled, ending it: %v", pr.group.Name, err)
+				ps.abortStream(c, pr, err)
+				return collector.Result()
+			}
 			logUpstreamError("reading from upstream", err)
-			return
+			return collector.Result()
 		}
 	}
+
+	return collector.Result()
 }
 
-func (ps *ProxyServer) handleNormalResponse(c *gin.Context, resp *http.Response) {
-	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+func (ps *ProxyServer) handleNormalResponse(c *gin.Context, resp *http.Response, pr *proxyRequest) *models.TokenUsage {
+	collector := newUsageCollector(pr.channelHandler, resp)
+
+	writers := []io.Writer{c.Writer}
+	if collector != nil {
+		writers = append(writers, collector)
+	}
+	if pr.cacheCapture != nil {
+		writers = append(writers, pr.cacheCapture)
+	}
+	if pr.resourceCapture != nil {
+		writers = append(writers, pr.resourceCapture)
+	}
+	dst := io.MultiWriter(writers...)
+
+	src := ps.responseReader(c, resp, pr)
+	if pr.plugins.hasResponseHooks() {
+		body, err := ps.transformResponse(c, resp.StatusCode, pr, src)
+		if err != nil {
+			return collector.Result()
+		}
+		src = bytes.NewReader(body)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
 		logUpstreamError("copying response body", err)
+		if pr.cacheCapture != nil {
+			// Never cache a truncated body.
+			pr.cacheCapture.overflow = true
+		}
+		if pr.resourceCapture != nil {
+			pr.resourceCapture.overflow = true
+		}
+	}
+
+	return collector.Result()
+}
+
+// transformResponse buffers a complete response body and runs the group's response hooks on it.
+// It writes an error response itself when a hook fails.
+func (ps *ProxyServer) transformResponse(c *gin.Context, statusCode int, pr *proxyRequest, src io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(src)
+	if err != nil {
+		logUpstreamError("reading response body", err)
+		return nil, err
+	}
+	body, err = pr.plugins.afterResponse(pr.pluginCtx, statusCode, body)
+	if err != nil {
+		logrus.Errorf("Failed to transform response for group %s: %v", pr.group.Name, err)
+		ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrBadGateway, "Failed to transform upstream response"))
+		return nil, err
+	}
+	c.Writer.Header().Del("Content-Length")
+	return body, nil
+}
+
+// isConvertedResponseHeader reports whether an upstream header describes the native body and must not be copied.
+func isConvertedResponseHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "Content-Length", "Content-Encoding", "Content-Type":
+		return true
+	}
+	return false
+}
+
+// handleConvertedResponse translates a native upstream response into the group's inbound format.
+func (ps *ProxyServer) handleConvertedResponse(c *gin.Context, resp *http.Response, pr *proxyRequest) *models.TokenUsage {
+	if resp.StatusCode >= 400 {
+		errorBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			logUpstreamError("reading error body", err)
+		}
+		errorBody = handleGzipCompression(resp, errorBody)
+		c.Data(resp.StatusCode, "application/json", pr.adapter.ConvertError(resp.StatusCode, errorBody))
+		return nil
+	}
+
+	if pr.isStream {
+		return ps.handleConvertedStreamingResponse(c, resp, pr)
+	}
+
+	body, err := io.ReadAll(ps.responseReader(c, resp, pr))
+	if err != nil {
+		logUpstreamError("reading response body", err)
+		return nil
+	}
+	body = handleGzipCompression(resp, body)
+	usage := pr.channelHandler.ExtractUsage(body)
+
+	converted, err := pr.adapter.ConvertResponse(body)
+	if err != nil {
+		logrus.Warnf("Failed to convert response for group %s: %v", pr.group.Name, err)
+		c.Data(http.StatusBadGateway, "application/json", pr.adapter.ConvertError(http.StatusBadGateway, body))
+		return usage
+	}
+	if pr.plugins.hasResponseHooks() {
+		if converted, err = pr.plugins.afterResponse(pr.pluginCtx, resp.StatusCode, converted); err != nil {
+			logrus.Errorf("Failed to transform response for group %s: %v", pr.group.Name, err)
+			ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrBadGateway, "Failed to transform upstream response"))
+			return usage
+		}
+	}
+	c.Data(resp.StatusCode, "application/json", converted)
+	if pr.cacheCapture != nil {
+		pr.cacheCapture.Write(converted)
+	}
+
+	return usage
+}
+
+// handleConvertedStreamingResponse translates native SSE events one by one and flushes them to the client.
+func (ps *ProxyServer) handleConvertedStreamingResponse(c *gin.Context, resp *http.Response, pr *proxyRequest) *models.TokenUsage {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(resp.StatusCode)
+
+	flusher, _ := c.Writer.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	converter := pr.adapter.NewStreamConverter()
+	usage := &models.TokenUsage{}
+
+	err := readSSEEvents(ps.responseReader(c, resp, pr), func(ev sseEvent) error {
+		if len(ev.Data) == 0 || string(ev.Data) == "[DONE]" {
+			return nil
+		}
+		usage.Merge(pr.channelHandler.ExtractUsage(ev.Data))
+
+		out, convErr := converter.Convert(ev.Event, ev.Data)
+		if convErr != nil {
+			logrus.Debugf("Skipping unconvertible stream event for group %s: %v", pr.group.Name, convErr)
+			return nil
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		if _, writeErr := c.Writer.Write(out); writeErr != nil {
+			return writeErr
+		}
+		flush()
+		return nil
+	})
+	if errors.Is(err, errStreamIdleTimeout) {
+		logrus.Warnf("Stream for group %s stalled, ending it: %v", pr.group.Name, err)
+		ps.abortStream(c, pr, err)
+	} else if err != nil {
+		logUpstreamError("converting stream", err)
+	} else if _, writeErr := c.Writer.Write(converter.Finish()); writeErr != nil {
+		logUpstreamError("writing stream to client", writeErr)
+	} else {
+		flush()
+	}
+
+	if usage.IsZero() {
+		return nil
 	}
+	return usage
 }
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// retryDecision describes how a failed upstream attempt is handled.
+type retryDecision struct {
+	// Retry means the request is sent again with another key; otherwise the error is returned to the client.
+	Retry bool
+	// PenalizeKey means the failure counts towards the key's blacklist threshold.
+	PenalizeKey bool
+}
+
+// classifyUpstreamError applies the group's retry policy to a failed attempt.
+// Transport errors (statusCode 0) are always retried and count against the key, so that a key whose requests
+// keep failing is eventually blacklisted; the caller lifts the penalty when the upstream circuit takes the blame.
+func classifyUpstreamError(cfg types.SystemSettings, statusCode int, errorBody string) retryDecision {
+	if statusCode == 0 {
+		return retryDecision{Retry: true, PenalizeKey: true}
+	}
+
+	lowerBody := strings.ToLower(errorBody)
+	decision := retryDecision{
+		PenalizeKey: matchStatusCodes(cfg.KeyPenaltyStatusCodes, statusCode) || containsAnyPattern(lowerBody, cfg.KeyPenaltyErrorPatterns),
+	}
+	// A failure caused by the key is always worth retrying with another one.
+	decision.Retry = decision.PenalizeKey ||
+		matchStatusCodes(cfg.RetryStatusCodes, statusCode) ||
+		containsAnyPattern(lowerBody, cfg.RetryErrorPatterns)
+
+	return decision
+}
+
+// isFallbackError reports whether a failed attempt should skip the remaining retries and go to the next fallback model.
+func isFallbackError(cfg types.SystemSettings, statusCode int, errorBody string) bool {
+	return matchStatusCodes(cfg.FallbackStatusCodes, statusCode) || containsAnyPattern(strings.ToLower(errorBody), cfg.FallbackErrorPatterns)
+}
+
+// matchStatusCodes reports whether the status code is listed in a status code setting.
+func matchStatusCodes(setting string, statusCode int) bool {
+	ranges, err := utils.ParseStatusCodeRanges(setting)
+	if err != nil {
+		logrus.Warnf("Ignoring invalid status code list '%s': %v", setting, err)
+		return false
+	}
+	return utils.MatchStatusCode(ranges, statusCode)
+}
+
+// containsAnyPattern reports whether the lowercased text contains any of the comma-separated patterns.
+func containsAnyPattern(lowerText, patterns string) bool {
+	for _, pattern := range utils.SplitAndTrim(patterns, ",") {
+		if strings.Contains(lowerText, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackoff returns the delay before the given retry attempt (1-based), doubling each time up to the configured maximum.
+func retryBackoff(cfg types.SystemSettings, attempt int) time.Duration {
+	if cfg.RetryBackoffMs <= 0 || attempt <= 0 {
+		return 0
+	}
+
+	delay := time.Duration(cfg.RetryBackoffMs) * time.Millisecond
+	maxDelay := time.Duration(cfg.RetryBackoffMaxMs) * time.Millisecond
+	for i := 1; i < attempt && (maxDelay <= 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// retryDelayPattern matches the RetryInfo detail of Gemini quota errors, e.g. "retryDelay": "37s".
+var retryDelayPattern = regexp.MustCompile(`"retryDelay"\s*:\s*"([0-9.]+s)"`)
+
+// rateLimitCooldown returns how long a rate limited key should be left out of rotation.
+// The delay requested by the upstream takes precedence over the configured default; 0 disables the cooldown.
+func rateLimitCooldown(cfg types.SystemSettings, header http.Header, errorBody []byte) time.Duration {
+	if cfg.KeyCooldownSeconds <= 0 {
+		return 0
+	}
+
+	if retryAfter := strings.TrimSpace(header.Get("Retry-After")); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil && time.Until(at) > 0 {
+			return time.Until(at)
+		}
+	}
+
+	if match := retryDelayPattern.FindSubmatch(errorBody); match != nil {
+		if delay, err := time.ParseDuration(string(match[1])); err == nil && delay > 0 {
+			return delay
+		}
+	}
+
+	return time.Duration(cfg.KeyCooldownSeconds) * time.Second
+}
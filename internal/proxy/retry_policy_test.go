@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"testing"
+
+	"gpt-load/internal/types"
+)
+
+func TestClassifyUpstreamError(t *testing.T) {
+	defaults := types.SystemSettings{
+		RetryStatusCodes:      "401,403,408,429,500-599",
+		KeyPenaltyStatusCodes: "401,403",
+	}
+
+	tests := []struct {
+		name       string
+		cfg        types.SystemSettings
+		statusCode int
+		body       string
+		want       retryDecision
+	}{
+		{
+			name: "transport error",
+			cfg:  defaults,
+			want: retryDecision{Retry: true, PenalizeKey: true},
+		},
+		{
+			name:       "invalid key",
+			cfg:        defaults,
+			statusCode: 401,
+			body:       `{"error":{"message":"Incorrect API key provided"}}`,
+			want:       retryDecision{Retry: true, PenalizeKey: true},
+		},
+		{
+			name:       "rate limited",
+			cfg:        defaults,
+			statusCode: 429,
+			want:       retryDecision{Retry: true},
+		},
+		{
+			name:       "server error",
+			cfg:        defaults,
+			statusCode: 503,
+			want:       retryDecision{Retry: true},
+		},
+		{
+			name:       "bad request",
+			cfg:        defaults,
+			statusCode: 400,
+			body:       `{"error":{"message":"max_tokens is too large"}}`,
+			want:       retryDecision{},
+		},
+		{
+			name: "retry pattern on non-retryable status",
+			cfg: types.SystemSettings{
+				RetryStatusCodes:   "429",
+				RetryErrorPatterns: "Quota Exceeded",
+			},
+			statusCode: 400,
+			body:       `{"error":{"message":"quota exceeded for this key"}}`,
+			want:       retryDecision{Retry: true},
+		},
+		{
+			name: "penalty pattern implies retry",
+			cfg: types.SystemSettings{
+				RetryStatusCodes:        "429",
+				KeyPenaltyErrorPatterns: "api key not valid",
+			},
+			statusCode: 400,
+			body:       `{"error":{"message":"API key not valid. Please pass a valid API key."}}`,
+			want:       retryDecision{Retry: true, PenalizeKey: true},
+		},
+		{
+			name:       "status code range",
+			cfg:        types.SystemSettings{RetryStatusCodes: "500-599"},
+			statusCode: 529,
+			want:       retryDecision{Retry: true},
+		},
+		{
+			name:       "invalid status code list is ignored",
+			cfg:        types.SystemSettings{RetryStatusCodes: "abc"},
+			statusCode: 500,
+			want:       retryDecision{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyUpstreamError(tt.cfg, tt.statusCode, tt.body); got != tt.want {
+				t.Fatalf("classifyUpstreamError() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,13 +2,16 @@
 package proxy
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"gpt-load/internal/channel"
@@ -18,10 +21,12 @@ import (
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
 	"gpt-load/internal/services"
+	"gpt-load/internal/store"
 	"gpt-load/internal/types"
 	"gpt-load/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
@@ -32,6 +37,8 @@ type ProxyServer struct {
 	settingsManager   *config.SystemSettingsManager
 	channelFactory    *channel.Factory
 	requestLogService *services.RequestLogService
+	store             store.Store
+	pipelines         pipelineCache
 }
 
 // NewProxyServer creates a new proxy server
@@ -41,6 +48,7 @@ func NewProxyServer(
 	settingsManager *config.SystemSettingsManager,
 	channelFactory *channel.Factory,
 	requestLogService *services.RequestLogService,
+	store store.Store,
 ) (*ProxyServer, error) {
 	return &ProxyServer{
 		keyProvider:       keyProvider,
@@ -48,9 +56,60 @@ func NewProxyServer(
 		settingsManager:   settingsManager,
 		channelFactory:    channelFactory,
 		requestLogService: requestLogService,
+		store:             store,
 	}, nil
 }
 
+// proxyRequest carries the per-request state shared by the retry loop and request logging.
+type proxyRequest struct {
+	group          *models.Group
+	channelHandler channel.ChannelProxy
+	adapter        formatAdapter
+	bodyBytes      []byte
+	rawBody        *requestBody // set instead of bodyBytes for spooled and streamed bodies
+	isStream       bool
+	startTime      time.Time
+	requestURL     *url.URL
+	model          string
+	upstreamModel  string
+
+	// Set when the group is a member of an aggregate group.
+	aggregateGroup *models.Group
+	canFailover    bool
+
+	// Identifies the conversation when key affinity is enabled for the group.
+	affinityKey string
+
+	// Stateful objects referenced by the request, which must be used with the key that created them.
+	resourceIDs     []string
+	resourceCapture *responseCapture
+
+	// The group's transformation pipeline and the state its plugins share.
+	plugins   pluginPipeline
+	pluginCtx *PluginContext
+
+	// Set when the response cache is enabled for the request.
+	cacheKey     string
+	cacheCapture *responseCapture
+	cacheHit     bool
+
+	// The close code of a relayed WebSocket session.
+	closeCode int
+
+	// Set when the upstream stream stalled after the response had started.
+	streamErr error
+
+	// Set when the proxy asked for stream usage itself, so the usage-only chunk must not reach the client.
+	stripUsageChunk bool
+
+	// The client's request as received, kept to prepare fallback requests.
+	entryName string
+	body      *requestBody
+	// The fallback model serving the request, as written in the chain, and the fallbacks left after it.
+	fallback  string
+	fallbacks []string
+}
+
 // HandleProxy is the main entry point for proxy requests, refactored based on the stable .bak logic.
 func (ps *ProxyServer) HandleProxy(c *gin.Context) {
 	startTime := time.Now()
@@ -62,98 +121,214 @@ func (ps *ProxyServer) HandleProxy(c *gin.Context) {
 		return
 	}
 
-	channelHandler, err := ps.channelFactory.GetChannel(group)
-	if err != nil {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to get channel for group '%s': %v", groupName, err)))
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		ps.handleWebSocketProxy(c, group, startTime)
 		return
 	}
 
-	bodyBytes, err := io.ReadAll(c.Request.Body)
+	// A body sent only once can be streamed through; retries and aggregate failover need to resend it.
+	canStream := !group.IsAggregate() && group.EffectiveConfig.MaxRetries == 0
+	body, err := readRequestBody(c, group, canStream)
 	if err != nil {
+		if apiErr := requestTooLargeError(err); apiErr != nil {
+			channel.WriteError(c, group.ClientFormat(), apiErr)
+			return
+		}
 		logrus.Errorf("Failed to read request body: %v", err)
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Failed to read request body"))
+		channel.WriteError(c, group.ClientFormat(), app_errors.NewAPIError(app_errors.ErrBadRequest, "Failed to read request body"))
 		return
 	}
-	c.Request.Body.Close()
+	defer body.Close()
+	startPayloadCapture(c, group, body)
 
-	finalBodyBytes, err := ps.applyParamOverrides(bodyBytes, group)
-	if err != nil {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to apply parameter overrides: %v", err)))
+	if group.IsAggregate() {
+		ps.handleAggregateProxy(c, group, body, startTime)
 		return
 	}
 
-	isStream := channelHandler.IsStreamRequest(c, bodyBytes)
+	pr, ok := ps.prepareRequest(c, group, group.Name, body, startTime)
+	if !ok {
+		return
+	}
+	if err := checkModelAccess(c, group, pr.model, pr.upstreamModel); err != nil {
+		ps.rejectModel(c, pr, err)
+		return
+	}
+	ps.executeRequestWithRetry(c, pr, 0, nil)
+}
+
+// prepareRequest builds the upstream request state for a group: format translation, model mapping and parameter overrides.
+// entryName is the group name used in the client's URL, which differs from the group's own name for aggregate members.
+// It writes the error response itself and returns false if the request cannot be sent.
+func (ps *ProxyServer) prepareRequest(c *gin.Context, group *models.Group, entryName string, body *requestBody, startTime time.Time) (*proxyRequest, bool) {
+	channelHandler, err := ps.channelFactory.GetChannel(group)
+	if err != nil {
+		channel.WriteError(c, group.ClientFormat(), app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to get channel for group '%s': %v", group.Name, err)))
+		return nil, false
+	}
+
+	bodyBytes := body.bytes()
+	clientBody := bodyBytes
+	relativePath := strings.TrimPrefix(c.Request.URL.Path, "/proxy/"+entryName)
+	pr := &proxyRequest{
+		group:          group,
+		channelHandler: channelHandler,
+		startTime:      startTime,
+		entryName:      entryName,
+		body:           body,
+		requestURL: &url.URL{
+			Path:     "/proxy/" + group.Name + relativePath,
+			RawQuery: c.Request.URL.RawQuery,
+		},
+	}
+
+	// Translate the request when the group exposes a different API format than its channel.
+	pr.adapter = newFormatAdapter(group.InboundFormat, group.ChannelType, channelHandler, c.Request.Method, relativePath)
+	if pr.adapter != nil {
+		converted, err := pr.adapter.ConvertRequest(bodyBytes)
+		if err != nil {
+			ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrBadRequest, err.Error()))
+			ps.logRequest(c, pr, nil, http.StatusBadRequest, 0, err, "", nil)
+			return nil, false
+		}
+		bodyBytes = converted.Body
+		pr.isStream = converted.IsStream
+		pr.model = converted.Model
+		pr.requestURL = &url.URL{
+			Path:     "/proxy/" + group.Name + converted.Path,
+			RawQuery: converted.RawQuery,
+		}
+	} else {
+		pr.isStream = channelHandler.IsStreamRequest(c, bodyBytes)
+		pr.model = channelHandler.ExtractModel(c, bodyBytes)
+		if pr.isStream && group.ChannelType == "openai" && isOpenAIChatPath(c.Request.Method, relativePath) {
+			bodyBytes, pr.stripUsageChunk = requestStreamUsage(bodyBytes)
+		}
+	}
 
-	ps.executeRequestWithRetry(c, channelHandler, group, finalBodyBytes, isStream, startTime, 0, nil)
+	pr.plugins, err = ps.pipelineFor(group)
+	if err != nil {
+		ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build plugin pipeline for group '%s': %v", group.Name, err)))
+		return nil, false
+	}
+	pr.pluginCtx = &PluginContext{
+		Gin:        c,
+		Group:      group,
+		Channel:    channelHandler,
+		RequestURL: pr.requestURL,
+		Model:      pr.model,
+		Body:       bodyBytes,
+		IsStream:   pr.isStream,
+	}
+	if err := pr.plugins.beforeRequest(pr.pluginCtx); err != nil {
+		ps.respondError(c, pr, requestHookError(err))
+		return nil, false
+	}
+	pr.requestURL = pr.pluginCtx.RequestURL
+	pr.upstreamModel = pr.pluginCtx.UpstreamModel
+	pr.bodyBytes = pr.pluginCtx.Body
+	if body.isRaw() {
+		pr.rawBody = body
+	}
+
+	pr.affinityKey = keyAffinityID(c, group, clientBody)
+	pr.resourceIDs = referencedResourceIDs(relativePath, clientBody)
+
+	if group.EffectiveConfig.ResponseCacheEnabled && !pr.isStream && pr.rawBody == nil && !isCacheBypassed(c) {
+		pr.cacheKey = responseCacheKey(c, pr, clientBody)
+	}
+
+	return pr, true
 }
 
 // executeRequestWithRetry is the core recursive function for handling requests and retries.
+// It returns false without writing a response when the group has no usable keys or exhausted its retries
+// and the caller can fail over to another group.
 func (ps *ProxyServer) executeRequestWithRetry(
 	c *gin.Context,
-	channelHandler channel.ChannelProxy,
-	group *models.Group,
-	bodyBytes []byte,
-	isStream bool,
-	startTime time.Time,
+	pr *proxyRequest,
 	retryCount int,
 	retryErrors []types.RetryError,
-) {
+) bool {
+	group := pr.group
+	channelHandler := pr.channelHandler
 	cfg := group.EffectiveConfig
 	if retryCount > cfg.MaxRetries {
+		if pr.canFailover {
+			logrus.Debugf("Max retries exceeded for group %s after %d attempts, failing over to the next member of %s", group.Name, retryCount, pr.aggregateGroup.Name)
+			return false
+		}
+		if ps.serveFallback(c, pr) {
+			return true
+		}
 		if len(retryErrors) > 0 {
 			lastError := retryErrors[len(retryErrors)-1]
-			var errorJSON map[string]any
-			if err := json.Unmarshal([]byte(lastError.ErrorMessage), &errorJSON); err == nil {
-				c.JSON(lastError.StatusCode, errorJSON)
-			} else {
-				response.Error(c, app_errors.NewAPIErrorWithUpstream(lastError.StatusCode, "UPSTREAM_ERROR", lastError.ErrorMessage))
-			}
-			logMessage := lastError.ParsedErrorMessage
-			if logMessage == "" {
-				logMessage = lastError.ErrorMessage
-			}
-			logrus.Debugf("Max retries exceeded for group %s after %d attempts. Parsed Error: %s", group.Name, retryCount, logMessage)
-
-			ps.logRequest(c, group, &models.APIKey{KeyValue: lastError.KeyValue}, startTime, lastError.StatusCode, retryCount, errors.New(logMessage), isStream, lastError.UpstreamAddr, channelHandler, bodyBytes)
+			logrus.Debugf("Max retries exceeded for group %s after %d attempts. Parsed Error: %s", group.Name, retryCount, lastError.ParsedErrorMessage)
+			ps.respondUpstreamError(c, pr, lastError, retryCount)
 		} else {
-			response.Error(c, app_errors.ErrMaxRetriesExceeded)
+			ps.respondError(c, pr, app_errors.ErrMaxRetriesExceeded)
 			logrus.Debugf("Max retries exceeded for group %s after %d attempts.", group.Name, retryCount)
-			ps.logRequest(c, group, nil, startTime, http.StatusServiceUnavailable, retryCount, app_errors.ErrMaxRetriesExceeded, isStream, "", channelHandler, bodyBytes)
+			ps.logRequest(c, pr, nil, http.StatusServiceUnavailable, retryCount, app_errors.ErrMaxRetriesExceeded, "", nil)
 		}
-		return
+		return true
 	}
 
-	apiKey, err := ps.keyProvider.SelectKey(group.ID)
+	if retryCount == 0 && pr.cacheKey != "" && ps.serveCachedResponse(c, pr) {
+		return true
+	}
+
+	apiKey, err := ps.selectKey(group, pr)
 	if err != nil {
+		if pr.canFailover && errors.Is(err, app_errors.ErrNoActiveKeys) {
+			logrus.Debugf("No active keys in group %s, failing over to the next member of %s", group.Name, pr.aggregateGroup.Name)
+			return false
+		}
+		if errors.Is(err, app_errors.ErrNoActiveKeys) && ps.serveFallback(c, pr) {
+			return true
+		}
 		logrus.Errorf("Failed to select a key for group %s on attempt %d: %v", group.Name, retryCount+1, err)
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, err.Error()))
-		ps.logRequest(c, group, nil, startTime, http.StatusServiceUnavailable, retryCount, err, isStream, "", channelHandler, bodyBytes)
-		return
+		ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, err.Error()))
+		ps.logRequest(c, pr, nil, http.StatusServiceUnavailable, retryCount, err, "", nil)
+		return true
 	}
 
-	upstreamURL, err := channelHandler.BuildUpstreamURL(c.Request.URL, group)
+	upstreamURL, err := channelHandler.BuildUpstreamURL(pr.requestURL, group)
 	if err != nil {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build upstream URL: %v", err)))
-		return
+		ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build upstream URL: %v", err)))
+		return true
 	}
+	// The upstream counts as busy until the response has been relayed or the attempt is abandoned.
+	releaseUpstream := sync.OnceFunc(func() { channelHandler.ReleaseUpstream(upstreamURL) })
+	defer releaseUpstream()
 
 	var ctx context.Context
 	var cancel context.CancelFunc
-	if isStream {
-		ctx, cancel = context.WithCancel(c.Request.Context())
+	var watchdog *streamWatchdog
+	if pr.isStream {
+		var cancelCause context.CancelCauseFunc
+		ctx, cancelCause = context.WithCancelCause(c.Request.Context())
+		cancel = func() { cancelCause(context.Canceled) }
+		watchdog = newStreamWatchdog(ctx, cancelCause, cfg)
+		defer watchdog.stop()
 	} else {
 		timeout := time.Duration(cfg.RequestTimeout) * time.Second
 		ctx, cancel = context.WithTimeout(c.Request.Context(), timeout)
 	}
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, c.Request.Method, upstreamURL, bytes.NewReader(bodyBytes))
+	bodyReader, contentLength, err := pr.bodyReader()
+	if err != nil {
+		logrus.Errorf("Failed to read request body for upstream request: %v", err)
+		ps.respondError(c, pr, app_errors.ErrInternalServer)
+		return true
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, upstreamURL, bodyReader)
 	if err != nil {
 		logrus.Errorf("Failed to create upstream request: %v", err)
-		response.Error(c, app_errors.ErrInternalServer)
-		return
+		ps.respondError(c, pr, app_errors.ErrInternalServer)
+		return true
 	}
-	req.ContentLength = int64(len(bodyBytes))
+	req.ContentLength = contentLength
 
 	req.Header = c.Request.Header.Clone()
 
@@ -165,114 +340,271 @@ func (ps *ProxyServer) executeRequestWithRetry(
 	q.Del("key")
 	req.URL.RawQuery = q.Encode()
 
-	// Apply custom header rules
-	if len(group.HeaderRuleList) > 0 {
-		headerCtx := utils.NewHeaderVariableContextFromGin(c, group, apiKey)
-		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
+	if requestID := c.GetString("requestID"); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	if pr.adapter != nil || pr.upstreamModel != "" || pr.cacheKey != "" || pr.plugins.hasResponseHooks() {
+		// Rewritten and cached responses are decoded by the proxy, so ask for an uncompressed body.
+		req.Header.Del("Accept-Encoding")
+	}
+	if pr.adapter != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if err := pr.plugins.beforeSend(pr.pluginCtx, req, apiKey); err != nil {
+		logrus.Errorf("Failed to prepare upstream request for group %s: %v", group.Name, err)
+		ps.respondError(c, pr, app_errors.ErrInternalServer)
+		return true
 	}
 
 	channelHandler.ModifyRequest(req, apiKey, group)
 
 	var client *http.Client
-	if isStream {
+	if pr.isStream {
 		client = channelHandler.GetStreamClient()
 		req.Header.Set("X-Accel-Buffering", "no")
 	} else {
 		client = channelHandler.GetHTTPClient()
 	}
 
+	sentAt := time.Now()
+	watchdog.start()
 	resp, err := client.Do(req)
+	if timeoutErr := watchdog.timeoutErr(); err != nil && timeoutErr != nil {
+		err = timeoutErr
+	}
+	var eventErr *streamEventError
+	if err == nil && resp.StatusCode < 400 && pr.isStream {
+		if err = watchdog.awaitFirstByte(resp); err == nil {
+			eventErr = peekStreamError(resp, channelHandler)
+		}
+	}
+	// For streams this is the time to the first byte of the response.
+	latency := time.Since(sentAt)
 	if resp != nil {
 		defer resp.Body.Close()
+		if err == nil && resp.StatusCode < http.StatusInternalServerError && (eventErr == nil || eventErr.statusCode < http.StatusInternalServerError) {
+			channelHandler.MarkUpstreamSuccess(upstreamURL, latency)
+		}
 	}
 
 	// Unified error handling for retries.
-	// Exclude 404 from being a retryable error.
-	if err != nil || (resp != nil && resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound) {
+	// The group's retry policy decides whether an error is retried, blamed on the key or returned as is.
+	if err != nil || (resp != nil && resp.StatusCode >= 400) || eventErr != nil {
+		if apiErr := requestTooLargeError(err); apiErr != nil {
+			// A streamed body exceeded the size limit while it was being sent.
+			ps.respondError(c, pr, apiErr)
+			ps.logRequest(c, pr, apiKey, http.StatusRequestEntityTooLarge, retryCount+1, err, upstreamURL, nil)
+			return true
+		}
 		if err != nil && app_errors.IsIgnorableError(err) {
 			logrus.Debugf("Client-side ignorable error for key %s, aborting retries: %v", utils.MaskAPIKey(apiKey.KeyValue), err)
-			ps.logRequest(c, group, apiKey, startTime, 499, retryCount+1, err, isStream, upstreamURL, channelHandler, bodyBytes)
-			return
+			ps.logRequest(c, pr, apiKey, 499, retryCount+1, err, upstreamURL, nil)
+			return true
 		}
 
-		ps.keyProvider.UpdateStatus(apiKey, group, false)
-
 		var statusCode int
 		var errorMessage string
 		var parsedError string
+		var decision retryDecision
 
 		if err != nil {
 			statusCode = 500
+			if errors.Is(err, errStreamFirstByteTimeout) {
+				statusCode = http.StatusGatewayTimeout
+			}
 			errorMessage = err.Error()
+			decision = classifyUpstreamError(cfg, 0, errorMessage)
 			logrus.Debugf("Request failed (attempt %d/%d) for key %s: %v", retryCount+1, cfg.MaxRetries, utils.MaskAPIKey(apiKey.KeyValue), err)
 		} else {
-			// HTTP-level error (status >= 400)
-			statusCode = resp.StatusCode
-			errorBody, readErr := io.ReadAll(resp.Body)
-			if readErr != nil {
-				logrus.Errorf("Failed to read error body: %v", readErr)
-				errorBody = []byte("Failed to read error body")
+			// HTTP-level error (status >= 400), or an error sent as the first event of a stream
+			var errorBody []byte
+			if eventErr != nil {
+				statusCode = eventErr.statusCode
+				errorBody = eventErr.data
+			} else {
+				statusCode = resp.StatusCode
+				var readErr error
+				errorBody, readErr = io.ReadAll(resp.Body)
+				if readErr != nil {
+					logrus.Errorf("Failed to read error body: %v", readErr)
+					errorBody = []byte("Failed to read error body")
+				}
+				errorBody = handleGzipCompression(resp, errorBody)
 			}
-
-			errorBody = handleGzipCompression(resp, errorBody)
 			errorMessage = string(errorBody)
 			parsedError = app_errors.ParseUpstreamError(errorBody)
+			decision = classifyUpstreamError(cfg, statusCode, errorMessage)
+			if statusCode == http.StatusTooManyRequests {
+				if cooldown := rateLimitCooldown(cfg, resp.Header, errorBody); cooldown > 0 {
+					ps.keyProvider.CooldownKey(apiKey, group, cooldown)
+					decision.PenalizeKey = false
+				}
+			}
 			logrus.Debugf("Request failed with status %d (attempt %d/%d) for key %s. Parsed Error: %s", statusCode, retryCount+1, cfg.MaxRetries, utils.MaskAPIKey(apiKey.KeyValue), parsedError)
 		}
 
-		newRetryErrors := append(retryErrors, types.RetryError{
+		// Connection errors and 5xx responses are blamed on the upstream when its health is tracked
+		// and another upstream can serve the retry.
+		if (err != nil || statusCode >= http.StatusInternalServerError) && channelHandler.MarkUpstreamFailure(upstreamURL) {
+			decision.PenalizeKey = false
+		}
+
+		if decision.PenalizeKey {
+			ps.keyProvider.UpdateStatus(apiKey, group, false)
+		}
+		if decision.Retry {
+			// Non-retryable errors are caused by the request itself and say nothing about the key.
+			if err != nil {
+				latency = 0
+			}
+			ps.keyProvider.RecordKeyOutcome(apiKey, group, false, latency)
+			// Let the retry pick another key and bind the conversation to it.
+			ps.keyProvider.ClearKeyAffinity(group, pr.affinityKey)
+		}
+		releaseUpstream()
+
+		retryError := types.RetryError{
 			StatusCode:         statusCode,
 			ErrorMessage:       errorMessage,
 			ParsedErrorMessage: parsedError,
 			KeyValue:           apiKey.KeyValue,
 			Attempt:            retryCount + 1,
 			UpstreamAddr:       upstreamURL,
-		})
-		ps.executeRequestWithRetry(c, channelHandler, group, bodyBytes, isStream, startTime, retryCount+1, newRetryErrors)
-		return
+		}
+		if isFallbackError(cfg, statusCode, errorMessage) && len(fallbacksFor(pr)) > 0 {
+			logrus.Debugf("Status %d of group %s skips the remaining retries for a fallback model", statusCode, group.Name)
+			return ps.executeRequestWithRetry(c, pr, cfg.MaxRetries+1, append(retryErrors, retryError))
+		}
+		if !decision.Retry {
+			logrus.Debugf("Status %d is not retryable for group %s, returning it to the client", statusCode, group.Name)
+			ps.respondUpstreamError(c, pr, retryError, retryCount+1)
+			return true
+		}
+
+		if delay := retryBackoff(cfg, retryCount+1); delay > 0 && retryCount < cfg.MaxRetries {
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+				ps.logRequest(c, pr, apiKey, 499, retryCount+1, c.Request.Context().Err(), upstreamURL, nil)
+				return true
+			}
+		}
+
+		return ps.executeRequestWithRetry(c, pr, retryCount+1, append(retryErrors, retryError))
 	}
 
 	// ps.keyProvider.UpdateStatus(apiKey, group, true) // 请求成功不再重置成功次数，减少IO消耗
+	ps.keyProvider.RecordKeyOutcome(apiKey, group, true, latency)
 	logrus.Debugf("Request for group %s succeeded on attempt %d with key %s", group.Name, retryCount+1, utils.MaskAPIKey(apiKey.KeyValue))
-	ps.logRequest(c, group, apiKey, startTime, resp.StatusCode, retryCount+1, nil, isStream, upstreamURL, channelHandler, bodyBytes)
 
 	for key, values := range resp.Header {
+		if pr.adapter != nil && isConvertedResponseHeader(key) {
+			continue
+		}
 		for _, value := range values {
 			c.Header(key, value)
 		}
 	}
-	c.Status(resp.StatusCode)
 
-	if isStream {
-		ps.handleStreamingResponse(c, resp)
+	ps.setDebugHeaders(c, pr, apiKey.ID, apiKey.KeyValue, retryCount+1, upstreamURL)
+	pr.prepareResponseCapture(c, resp.StatusCode)
+	pr.prepareResourceCapture(c, resp.StatusCode)
+
+	var usage *models.TokenUsage
+	if pr.adapter != nil {
+		usage = ps.handleConvertedResponse(c, resp, pr)
+	} else {
+		c.Status(resp.StatusCode)
+		if pr.isStream {
+			usage = ps.handleStreamingResponse(c, resp, pr)
+		} else {
+			usage = ps.handleNormalResponse(c, resp, pr)
+		}
+	}
+	ps.storeCachedResponse(c, pr)
+	ps.trackResources(c, pr, apiKey)
+
+	ps.logRequest(c, pr, apiKey, resp.StatusCode, retryCount+1, pr.streamErr, upstreamURL, usage)
+	return true
+}
+
+// respondUpstreamError returns an upstream error to the client and records it.
+func (ps *ProxyServer) respondUpstreamError(c *gin.Context, pr *proxyRequest, upstreamErr types.RetryError, retries int) {
+	ps.setDebugHeaders(c, pr, 0, upstreamErr.KeyValue, retries, upstreamErr.UpstreamAddr)
+
+	var errorJSON map[string]any
+	if pr.adapter != nil {
+		c.Data(upstreamErr.StatusCode, "application/json", pr.adapter.ConvertError(upstreamErr.StatusCode, []byte(upstreamErr.ErrorMessage)))
+	} else if err := json.Unmarshal([]byte(upstreamErr.ErrorMessage), &errorJSON); err == nil {
+		c.JSON(upstreamErr.StatusCode, errorJSON)
 	} else {
-		ps.handleNormalResponse(c, resp)
+		ps.respondError(c, pr, app_errors.NewAPIErrorWithUpstream(upstreamErr.StatusCode, "UPSTREAM_ERROR", upstreamErr.ErrorMessage))
+	}
+
+	logMessage := upstreamErr.ParsedErrorMessage
+	if logMessage == "" {
+		logMessage = upstreamErr.ErrorMessage
 	}
+	ps.logRequest(c, pr, &models.APIKey{KeyValue: upstreamErr.KeyValue}, upstreamErr.StatusCode, retries, errors.New(logMessage), upstreamErr.UpstreamAddr, nil)
+}
+
+// setDebugHeaders tells the client which group, key and upstream served the request when the group enables it.
+// keyID is 0 when only the key value is known.
+func (ps *ProxyServer) setDebugHeaders(c *gin.Context, pr *proxyRequest, keyID uint, keyValue string, attempts int, upstreamURL string) {
+	if !pr.group.EffectiveConfig.DebugResponseHeaders {
+		return
+	}
+	c.Header("X-GPT-Load-Group", pr.group.Name)
+	c.Header("X-GPT-Load-Attempts", strconv.Itoa(attempts))
+	if keyValue != "" {
+		key := utils.MaskAPIKey(keyValue)
+		if keyID != 0 {
+			key = fmt.Sprintf("%s (#%d)", key, keyID)
+		}
+		c.Header("X-GPT-Load-Key", key)
+	}
+	if u, err := url.Parse(upstreamURL); err == nil && u.Host != "" {
+		c.Header("X-GPT-Load-Upstream", u.Host)
+	}
+	if pr.fallback != "" {
+		c.Header("X-GPT-Load-Fallback", pr.fallback)
+	}
+}
+
+// respondError writes a proxy-generated error in the native error format of the channel,
+// or of the inbound format when the request was translated.
+func (ps *ProxyServer) respondError(c *gin.Context, pr *proxyRequest, apiErr *app_errors.APIError) {
+	if pr.adapter != nil || pr.channelHandler == nil {
+		// Aggregate groups without members have no channel, but speak their channel type's format.
+		channel.WriteError(c, pr.group.ClientFormat(), apiErr)
+		return
+	}
+	pr.channelHandler.WriteError(c, apiErr)
 }
 
 // logRequest is a helper function to create and record a request log.
 func (ps *ProxyServer) logRequest(
 	c *gin.Context,
-	group *models.Group,
+	pr *proxyRequest,
 	apiKey *models.APIKey,
-	startTime time.Time,
 	statusCode int,
 	retries int,
 	finalError error,
-	isStream bool,
 	upstreamAddr string,
-	channelHandler channel.ChannelProxy,
-	bodyBytes []byte,
+	usage *models.TokenUsage,
 ) {
 	if ps.requestLogService == nil {
 		return
 	}
 
-	duration := time.Since(startTime).Milliseconds()
+	duration := time.Since(pr.startTime).Milliseconds()
 
 	logEntry := &models.RequestLog{
-		GroupID:      group.ID,
-		GroupName:    group.Name,
+		RequestID:    c.GetString("requestID"),
+		GroupID:      pr.group.ID,
+		GroupName:    pr.group.Name,
 		IsSuccess:    finalError == nil && statusCode < 400,
 		SourceIP:     c.ClientIP(),
 		StatusCode:   statusCode,
@@ -280,21 +612,38 @@ func (ps *ProxyServer) logRequest(
 		Duration:     duration,
 		UserAgent:    c.Request.UserAgent(),
 		Retries:      retries,
-		IsStream:     isStream,
+		IsStream:     pr.isStream,
+		IsCacheHit:   pr.cacheHit,
 		UpstreamAddr: utils.TruncateString(upstreamAddr, 500),
+		Model:        pr.model,
+		CloseCode:    pr.closeCode,
+		Fallback:     pr.fallback,
+	}
+
+	logEntry.UpstreamModel = pr.model
+	if pr.upstreamModel != "" {
+		logEntry.UpstreamModel = pr.upstreamModel
 	}
 
-	if channelHandler != nil && bodyBytes != nil {
-		logEntry.Model = channelHandler.ExtractModel(c, bodyBytes)
+	if pr.aggregateGroup != nil {
+		logEntry.AggregateGroupID = pr.aggregateGroup.ID
+		logEntry.AggregateGroupName = pr.aggregateGroup.Name
 	}
 
 	if apiKey != nil {
 		logEntry.KeyValue = apiKey.KeyValue
 	}
 
+	if usage != nil {
+		logEntry.InputTokens = usage.InputTokens
+		logEntry.OutputTokens = usage.OutputTokens
+		logEntry.CachedTokens = usage.CachedTokens
+	}
+
 	if finalError != nil {
 		logEntry.ErrorMessage = finalError.Error()
 	}
+	logEntry.Payload = payloadFromContext(c)
 
 	if err := ps.requestLogService.Record(logEntry); err != nil {
 		logrus.Errorf("Failed to record request log: %v", err)
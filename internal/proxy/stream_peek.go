@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"gpt-load/internal/channel"
+)
+
+// maxStreamPeekSize bounds how much of a stream is held back while looking for its first event.
+const maxStreamPeekSize = 64 * 1024
+
+var errStreamPeekDone = errors.New("first stream event read")
+
+// streamEventError is an error an upstream sent as the first event of a stream it answered with 200.
+type streamEventError struct {
+	statusCode int
+	data       []byte
+}
+
+// peekStreamError reads the first data event of a server-sent event stream before anything is sent to the client,
+// so that an upstream that reports an error in it, e.g. when overloaded, can be retried like an HTTP error.
+// The response body is replaced by one that replays the peeked bytes.
+func peekStreamError(resp *http.Response, channelHandler channel.ChannelProxy) *streamEventError {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// e.g. the JSON array returned by Gemini's streamGenerateContent without alt=sse
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil
+	}
+
+	var peeked bytes.Buffer
+	var first *sseEvent
+	src := io.TeeReader(io.LimitReader(resp.Body, maxStreamPeekSize), &peeked)
+	readSSEEvents(src, func(ev sseEvent) error {
+		// Keep-alive comments and empty events may come before the first real event.
+		if len(bytes.TrimSpace(ev.Data)) == 0 {
+			return nil
+		}
+		first = &ev
+		return errStreamPeekDone
+	})
+	// Read errors are not handled here; the replayed body returns them to the response handler.
+	resp.Body = &replayBody{Reader: io.MultiReader(&peeked, resp.Body), Closer: resp.Body}
+
+	if first == nil {
+		return nil
+	}
+	statusCode, isError := channelHandler.ParseStreamError(first.Event, first.Data)
+	if !isError {
+		return nil
+	}
+	return &streamEventError{statusCode: statusCode, data: first.Data}
+}
+
+// replayBody reads the peeked part of a response body before the rest of it.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/channel"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errStreamFirstByteTimeout = errors.New("upstream sent no data within the stream first byte timeout")
+	errStreamIdleTimeout      = errors.New("upstream stream stalled longer than the stream idle timeout")
+)
+
+// streamWatchdog cancels a streaming attempt when the upstream stays silent for too long:
+// first until the first byte of the response body, then between two reads of the body.
+type streamWatchdog struct {
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	firstByte time.Duration
+	idle      time.Duration
+	timer     *time.Timer
+	started   atomic.Bool
+}
+
+// newStreamWatchdog returns nil when the group sets neither timeout; all methods accept a nil watchdog.
+func newStreamWatchdog(ctx context.Context, cancel context.CancelCauseFunc, cfg types.SystemSettings) *streamWatchdog {
+	if cfg.StreamFirstByteTimeout <= 0 && cfg.StreamIdleTimeout <= 0 {
+		return nil
+	}
+	return &streamWatchdog{
+		ctx:       ctx,
+		cancel:    cancel,
+		firstByte: time.Duration(cfg.StreamFirstByteTimeout) * time.Second,
+		idle:      time.Duration(cfg.StreamIdleTimeout) * time.Second,
+	}
+}
+
+// start arms the first byte timeout. Call it right before the request is sent.
+func (w *streamWatchdog) start() {
+	if w == nil || w.firstByte <= 0 {
+		return
+	}
+	w.timer = time.AfterFunc(w.firstByte, func() {
+		if !w.started.Load() {
+			w.cancel(errStreamFirstByteTimeout)
+		}
+	})
+}
+
+// stop disarms the watchdog once the attempt is over.
+func (w *streamWatchdog) stop() {
+	if w != nil && w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// timeoutErr returns the timeout that cancelled the attempt, if any.
+func (w *streamWatchdog) timeoutErr() error {
+	if w == nil {
+		return nil
+	}
+	if cause := context.Cause(w.ctx); errors.Is(cause, errStreamFirstByteTimeout) || errors.Is(cause, errStreamIdleTimeout) {
+		return cause
+	}
+	return nil
+}
+
+// received records data from the upstream: the first time it swaps the first byte timeout for the idle timeout,
+// afterwards it restarts the idle timeout.
+func (w *streamWatchdog) received() {
+	if w.started.CompareAndSwap(false, true) {
+		w.stop()
+		w.timer = nil
+		if w.idle > 0 {
+			w.timer = time.AfterFunc(w.idle, func() { w.cancel(errStreamIdleTimeout) })
+		}
+		return
+	}
+	if w.timer != nil {
+		w.timer.Reset(w.idle)
+	}
+}
+
+// awaitFirstByte reads the first chunk of a successful stream before anything is sent to the client,
+// so that an upstream that never starts streaming can still be retried with another key.
+// The response body is replaced by one that replays the chunk and keeps resetting the idle timeout.
+func (w *streamWatchdog) awaitFirstByte(resp *http.Response) error {
+	if w == nil {
+		return nil
+	}
+	if w.firstByte <= 0 {
+		// Only the idle timeout is set; it starts with the response headers.
+		w.received()
+	}
+	body := &watchedBody{ReadCloser: resp.Body, w: w}
+	resp.Body = body
+
+	buf := make([]byte, 4*1024)
+	n, err := body.Read(buf)
+	if n == 0 && err != nil {
+		if timeoutErr := w.timeoutErr(); timeoutErr != nil {
+			return timeoutErr
+		}
+	}
+	body.pending = bytes.NewReader(buf[:n])
+	body.pendingErr = err
+	return nil
+}
+
+// watchedBody resets the watchdog on every read and reports its timeouts instead of the cancellation.
+type watchedBody struct {
+	io.ReadCloser
+	w          *streamWatchdog
+	pending    *bytes.Reader
+	pendingErr error
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	if b.pending != nil {
+		if b.pending.Len() > 0 {
+			return b.pending.Read(p)
+		}
+		b.pending = nil
+		if b.pendingErr != nil {
+			return 0, b.pendingErr
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.w.received()
+	}
+	if err != nil && err != io.EOF {
+		if timeoutErr := b.w.timeoutErr(); timeoutErr != nil {
+			err = timeoutErr
+		}
+	}
+	return n, err
+}
+
+// abortStream ends a stream the upstream stopped feeding with an SSE error event in the client's format
+// and marks the request as failed.
+func (ps *ProxyServer) abortStream(c *gin.Context, pr *proxyRequest, err error) {
+	pr.streamErr = err
+	format := pr.group.ClientFormat()
+	_, body := channel.FormatError(format, app_errors.NewAPIErrorWithUpstream(http.StatusGatewayTimeout, "GATEWAY_TIMEOUT", err.Error()))
+	event := "data: " + string(body) + "\n\n"
+	if format == "anthropic" {
+		event = "event: error\n" + event
+	}
+	if _, writeErr := c.Writer.Write([]byte(event)); writeErr != nil {
+		logUpstreamError("writing stream error to client", writeErr)
+		return
+	}
+	c.Writer.Flush()
+}
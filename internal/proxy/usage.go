@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"gpt-load/internal/channel"
+	"gpt-load/internal/models"
+)
+
+// maxUsageBufferSize caps how much of a response is kept in memory for usage parsing.
+const maxUsageBufferSize = 4 * 1024 * 1024
+
+var usageMarker = []byte(`"usage`)
+
+// usageCollector observes the response bytes forwarded to the client and extracts token usage.
+// SSE responses are parsed event by event; other JSON responses are buffered and parsed once complete.
+type usageCollector struct {
+	channelHandler channel.ChannelProxy
+	resp           *http.Response
+	isSSE          bool
+	pending        []byte
+	buffer         bytes.Buffer
+	overflow       bool
+	usage          *models.TokenUsage
+}
+
+// newUsageCollector returns a collector for the response, or nil if the payload cannot carry usage.
+func newUsageCollector(channelHandler channel.ChannelProxy, resp *http.Response) *usageCollector {
+	contentType := resp.Header.Get("Content-Type")
+	isSSE := strings.Contains(contentType, "text/event-stream")
+	if !isSSE && contentType != "" && !strings.Contains(contentType, "json") {
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		if isSSE || encoding != "gzip" {
+			return nil
+		}
+	}
+
+	return &usageCollector{
+		channelHandler: channelHandler,
+		resp:           resp,
+		isSSE:          isSSE,
+	}
+}
+
+// Write implements io.Writer so the collector can be fed from a tee.
+func (u *usageCollector) Write(p []byte) (int, error) {
+	if u.isSSE {
+		u.consumeLines(p)
+		return len(p), nil
+	}
+
+	if !u.overflow {
+		if u.buffer.Len()+len(p) > maxUsageBufferSize {
+			u.overflow = true
+			u.buffer.Reset()
+		} else {
+			u.buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// consumeLines splits SSE data into lines and inspects every complete "data:" line.
+func (u *usageCollector) consumeLines(p []byte) {
+	u.pending = append(u.pending, p...)
+	for {
+		idx := bytes.IndexByte(u.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimRight(u.pending[:idx], "\r")
+		u.observeEvent(line)
+		u.pending = u.pending[idx+1:]
+	}
+
+	if len(u.pending) > maxUsageBufferSize {
+		u.pending = nil
+	}
+}
+
+func (u *usageCollector) observeEvent(line []byte) {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	payload = bytes.TrimSpace(payload)
+	if !bytes.Contains(payload, usageMarker) {
+		return
+	}
+	u.merge(u.channelHandler.ExtractUsage(payload))
+}
+
+func (u *usageCollector) merge(usage *models.TokenUsage) {
+	if usage == nil {
+		return
+	}
+	if u.usage == nil {
+		u.usage = &models.TokenUsage{}
+	}
+	u.usage.Merge(usage)
+}
+
+// Result returns the collected usage, or nil if the upstream did not report any.
+func (u *usageCollector) Result() *models.TokenUsage {
+	if u == nil {
+		return nil
+	}
+
+	if u.isSSE {
+		if len(u.pending) > 0 {
+			u.observeEvent(bytes.TrimRight(u.pending, "\r"))
+			u.pending = nil
+		}
+	} else if !u.overflow && u.buffer.Len() > 0 {
+		body := handleGzipCompression(u.resp, u.buffer.Bytes())
+		if bytes.Contains(body, usageMarker) {
+			u.merge(u.channelHandler.ExtractUsage(body))
+		}
+		u.buffer.Reset()
+	}
+
+	return u.usage
+}
+
+// requestStreamUsage sets stream_options.include_usage on an OpenAI chat request, without which the stream
+// ends without token usage. It reports whether the option was added by the proxy rather than the client.
+func requestStreamUsage(body []byte) ([]byte, bool) {
+	data, ok := decodeJSONBody(body)
+	if !ok {
+		return body, false
+	}
+	options, _ := data["stream_options"].(map[string]any)
+	if options == nil {
+		options = make(map[string]any)
+	}
+	if includeUsage, _ := options["include_usage"].(bool); includeUsage {
+		return body, false
+	}
+	options["include_usage"] = true
+	data["stream_options"] = options
+
+	rewritten, err := json.Marshal(data)
+	if err != nil {
+		return body, false
+	}
+	return rewritten, true
+}
+
+// usageChunkFilter removes the usage-only chunk from an OpenAI chat stream whose client did not ask for usage.
+// Lines are held back until they are complete, so that the chunk can be recognized.
+type usageChunkFilter struct {
+	pending   []byte
+	skipBlank bool
+}
+
+// Filter returns the complete lines of p, and of the data held back before it, that are relayed to the client.
+func (f *usageChunkFilter) Filter(p []byte) []byte {
+	f.pending = append(f.pending, p...)
+	var out []byte
+	for {
+		idx := bytes.IndexByte(f.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := f.pending[:idx+1]
+		f.pending = f.pending[idx+1:]
+
+		content := bytes.TrimRight(line, "\r\n")
+		if len(content) == 0 && f.skipBlank {
+			// The blank line that ended the dropped chunk.
+			f.skipBlank = false
+			continue
+		}
+		f.skipBlank = false
+		if isUsageOnlyChunk(content) {
+			f.skipBlank = true
+			continue
+		}
+		out = append(out, line...)
+	}
+	return out
+}
+
+// Flush returns the data held back once the stream has ended.
+func (f *usageChunkFilter) Flush() []byte {
+	rest := f.pending
+	f.pending = nil
+	if isUsageOnlyChunk(bytes.TrimRight(rest, "\r")) {
+		return nil
+	}
+	return rest
+}
+
+// isUsageOnlyChunk reports whether an SSE line is the final chunk that carries usage and no choices.
+func isUsageOnlyChunk(line []byte) bool {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok || !bytes.Contains(payload, usageMarker) {
+		return false
+	}
+	var chunk struct {
+		Choices []json.RawMessage `json:"choices"`
+		Usage   json.RawMessage   `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(payload), &chunk); err != nil {
+		return false
+	}
+	return len(chunk.Choices) == 0 && len(chunk.Usage) > 0 && string(chunk.Usage) != "null"
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import "testing"
+
+func TestRequestStreamUsage(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		want         string
+		wantInjected bool
+	}{
+		{
+			name:         "no stream options",
+			body:         `{"model":"gpt-4o","stream":true}`,
+			want:         `{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":true}}`,
+			wantInjected: true,
+		},
+		{
+			name:         "usage disabled by client",
+			body:         `{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":false}}`,
+			want:         `{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":true}}`,
+			wantInjected: true,
+		},
+		{
+			name: "usage requested by client",
+			body: `{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":true}}`,
+			want: `{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name: "not JSON",
+			body: `model=gpt-4o`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, injected := requestStreamUsage([]byte(tt.body))
+			if injected != tt.wantInjected {
+				t.Fatalf("requestStreamUsage() injected = %v, want %v", injected, tt.wantInjected)
+			}
+			if tt.want == "" {
+				if string(got) != tt.body {
+					t.Fatalf("requestStreamUsage() = %s, want the body unchanged", got)
+				}
+				return
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestUsageChunkFilter(t *testing.T) {
+	const (
+		content = "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}],\"usage\":null}\n\n"
+		usage   = "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1}}\n\n"
+		done    = "data: [DONE]\n\n"
+	)
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "usage chunk removed",
+			chunks: []string{content, usage, done},
+			want:   content + done,
+		},
+		{
+			name:   "usage chunk split across reads",
+			chunks: []string{content + usage[:20], usage[20:] + done},
+			want:   content + done,
+		},
+		{
+			name:   "usage chunk without trailing newline",
+			chunks: []string{content, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3}}"},
+			want:   content,
+		},
+		{
+			name:   "chunks with choices kept",
+			chunks: []string{content, done},
+			want:   content + done,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := &usageChunkFilter{}
+			var got []byte
+			for _, chunk := range tt.chunks {
+				got = append(got, filter.Filter([]byte(chunk))...)
+			}
+			got = append(got, filter.Flush()...)
+			if string(got) != tt.want {
+				t.Fatalf("filtered stream = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
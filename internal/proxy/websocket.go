@@ -0,0 +1,470 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gpt-load/internal/channel"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// insecureKeyProtocolPrefix is the subprotocol browsers use to pass an API key to the OpenAI Realtime API,
+// since they cannot set headers on a WebSocket handshake. It carries the proxy key and is never forwarded.
+const insecureKeyProtocolPrefix = "openai-insecure-api-key."
+
+// webSocketHandshakeHeaders are generated by the WebSocket dialer and must not be copied from the client.
+var webSocketHandshakeHeaders = []string{
+	"Upgrade", "Connection", "Host", "Origin",
+	"Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol",
+	"Authorization", "X-Api-Key", "X-Goog-Api-Key",
+}
+
+// handleWebSocketProxy relays a WebSocket session, such as the OpenAI Realtime API, to the upstream with a pool key.
+// Failed handshakes are retried and fail over like HTTP requests; once both sides are connected, messages are
+// piped in both directions until either side closes.
+func (ps *ProxyServer) handleWebSocketProxy(c *gin.Context, group *models.Group, startTime time.Time) {
+	if !checkWebSocketOrigin(c.Request, group.EffectiveConfig.WebSocketAllowedOrigins) {
+		channel.WriteError(c, group.ClientFormat(), app_errors.NewAPIError(app_errors.ErrForbidden, "WebSocket connections are not allowed from origin "+c.GetHeader("Origin")))
+		return
+	}
+	if !group.IsAggregate() {
+		pr, ok := ps.prepareWebSocketRequest(c, group, group.Name, startTime)
+		if !ok {
+			return
+		}
+		if err := checkModelAccess(c, group, pr.model, pr.upstreamModel); err != nil {
+			ps.rejectModel(c, pr, err)
+			return
+		}
+		ps.executeWebSocket(c, pr, 0)
+		return
+	}
+
+	members := ps.resolveSubGroups(group)
+	if len(members) == 0 {
+		logrus.Warnf("Aggregate group %s has no available member groups", group.Name)
+		apiErr := app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, "No member groups are available in aggregate group "+group.Name)
+		pr := &proxyRequest{group: group, startTime: startTime}
+		ps.respondError(c, pr, apiErr)
+		ps.logRequest(c, pr, nil, http.StatusServiceUnavailable, 0, apiErr, "", nil)
+		return
+	}
+
+	var prepared []*proxyRequest
+	var deniedPR *proxyRequest
+	var denied error
+	for _, member := range members {
+		pr, ok := ps.prepareWebSocketRequest(c, member, group.Name, startTime)
+		if !ok {
+			return
+		}
+		pr.aggregateGroup = group
+		if err := checkModelAccess(c, group, pr.model, ""); err != nil {
+			ps.rejectModel(c, pr, err)
+			return
+		}
+		err := checkModelAccess(c, member, pr.model, pr.upstreamModel)
+		if err == nil && pr.upstreamModel != "" {
+			// The aggregate's rules also cover the model the member maps the request to.
+			err = checkModelAccess(c, group, pr.upstreamModel, "")
+		}
+		if err != nil {
+			logrus.Debugf("Skipping member group %s of aggregate group %s: %v", member.Name, group.Name, err)
+			deniedPR, denied = pr, err
+			continue
+		}
+		prepared = append(prepared, pr)
+	}
+	if len(prepared) == 0 {
+		ps.rejectModel(c, deniedPR, denied)
+		return
+	}
+
+	for i, pr := range prepared {
+		pr.canFailover = i < len(prepared)-1
+		if ps.executeWebSocket(c, pr, 0) {
+			return
+		}
+	}
+}
+
+// prepareWebSocketRequest builds the request state of a WebSocket session for a group.
+// The model of a Realtime session is given in the query string.
+func (ps *ProxyServer) prepareWebSocketRequest(c *gin.Context, group *models.Group, entryName string, startTime time.Time) (*proxyRequest, bool) {
+	channelHandler, err := ps.channelFactory.GetChannel(group)
+	if err != nil {
+		channel.WriteError(c, group.ClientFormat(), app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to get channel for group '%s': %v", group.Name, err)))
+		return nil, false
+	}
+	pipeline, err := ps.pipelineFor(group)
+	if err != nil {
+		channelHandler.WriteError(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build plugin pipeline for group '%s': %v", group.Name, err)))
+		return nil, false
+	}
+
+	relativePath := strings.TrimPrefix(c.Request.URL.Path, "/proxy/"+entryName)
+	query := c.Request.URL.Query()
+	query.Del("key")
+	pr := &proxyRequest{
+		group:          group,
+		channelHandler: channelHandler,
+		startTime:      startTime,
+		entryName:      entryName,
+		isStream:       true,
+		model:          query.Get("model"),
+		plugins:        pipeline,
+		requestURL:     &url.URL{Path: "/proxy/" + group.Name + relativePath, RawQuery: query.Encode()},
+	}
+	pr.pluginCtx = &PluginContext{
+		Gin:        c,
+		Group:      group,
+		Channel:    channelHandler,
+		RequestURL: pr.requestURL,
+		Model:      pr.model,
+		IsStream:   true,
+	}
+	// The session has no body, so hooks such as model mapping and param overrides only see the model and URL.
+	if err := pr.plugins.beforeRequest(pr.pluginCtx); err != nil {
+		ps.respondError(c, pr, requestHookError(err))
+		return nil, false
+	}
+	pr.upstreamModel = pr.pluginCtx.UpstreamModel
+	if pr.upstreamModel != "" {
+		// Channels rewrite the model in the body; a Realtime session names it in the query string.
+		rewritten := *pr.pluginCtx.RequestURL
+		query := rewritten.Query()
+		query.Set("model", pr.upstreamModel)
+		rewritten.RawQuery = query.Encode()
+		pr.pluginCtx.RequestURL = &rewritten
+	}
+	pr.requestURL = pr.pluginCtx.RequestURL
+	return pr, true
+}
+
+// executeWebSocket dials the upstream with a pool key and, once connected, upgrades the client and relays the session.
+// Like executeRequestWithRetry, it returns false without writing a response when the caller can fail over.
+func (ps *ProxyServer) executeWebSocket(c *gin.Context, pr *proxyRequest, retryCount int) bool {
+	group := pr.group
+	cfg := group.EffectiveConfig
+	if retryCount > cfg.MaxRetries {
+		if pr.canFailover {
+			return false
+		}
+		ps.respondError(c, pr, app_errors.ErrMaxRetriesExceeded)
+		ps.logRequest(c, pr, nil, http.StatusServiceUnavailable, retryCount, app_errors.ErrMaxRetriesExceeded, "", nil)
+		return true
+	}
+
+	apiKey, err := ps.selectKey(group, pr)
+	if err != nil {
+		if pr.canFailover && errors.Is(err, app_errors.ErrNoActiveKeys) {
+			return false
+		}
+		ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, err.Error()))
+		ps.logRequest(c, pr, nil, http.StatusServiceUnavailable, retryCount, err, "", nil)
+		return true
+	}
+
+	upstreamURL, err := pr.channelHandler.BuildUpstreamURL(pr.requestURL, group)
+	if err != nil {
+		ps.respondError(c, pr, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build upstream URL: %v", err)))
+		return true
+	}
+	releaseUpstream := sync.OnceFunc(func() { pr.channelHandler.ReleaseUpstream(upstreamURL) })
+	defer releaseUpstream()
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, upstreamURL, nil)
+	if err != nil {
+		ps.respondError(c, pr, app_errors.ErrInternalServer)
+		return true
+	}
+	req.Header = c.Request.Header.Clone()
+	for _, header := range webSocketHandshakeHeaders {
+		req.Header.Del(header)
+	}
+	if requestID := c.GetString("requestID"); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	if err := pr.plugins.beforeSend(pr.pluginCtx, req, apiKey); err != nil {
+		logrus.Errorf("Failed to prepare upstream WebSocket request for group %s: %v", group.Name, err)
+		ps.respondError(c, pr, app_errors.ErrInternalServer)
+		return true
+	}
+	pr.channelHandler.ModifyRequest(req, apiKey, group)
+
+	dialURL := *req.URL
+	switch dialURL.Scheme {
+	case "https":
+		dialURL.Scheme = "wss"
+	case "http":
+		dialURL.Scheme = "ws"
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: time.Duration(cfg.ConnectTimeout) * time.Second,
+		Subprotocols:     forwardedSubprotocols(c.Request),
+	}
+	if cfg.ProxyURL != "" {
+		if proxyURL, err := url.Parse(cfg.ProxyURL); err == nil {
+			dialer.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	sentAt := time.Now()
+	upstreamConn, resp, err := dialer.DialContext(c.Request.Context(), dialURL.String(), req.Header)
+	latency := time.Since(sentAt)
+	if resp != nil && resp.StatusCode < http.StatusInternalServerError {
+		pr.channelHandler.MarkUpstreamSuccess(upstreamURL, latency)
+	}
+	if err != nil {
+		retryErr, retry := ps.handleWebSocketDialError(c, pr, apiKey, upstreamURL, resp, err, retryCount)
+		releaseUpstream()
+		if !retry {
+			return true
+		}
+		if delay := retryBackoff(cfg, retryCount+1); delay > 0 && retryCount < cfg.MaxRetries {
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+				ps.logRequest(c, pr, apiKey, 499, retryCount+1, c.Request.Context().Err(), upstreamURL, nil)
+				return true
+			}
+		}
+		if retryCount >= cfg.MaxRetries && !pr.canFailover {
+			// Return the last handshake error rather than a generic one.
+			ps.respondUpstreamError(c, pr, retryErr, retryCount+1)
+			return true
+		}
+		return ps.executeWebSocket(c, pr, retryCount+1)
+	}
+	defer upstreamConn.Close()
+
+	upgrader := websocket.Upgrader{
+		// The origin was checked against the group's allowed origins before dialing the upstream.
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	if protocol := upstreamConn.Subprotocol(); protocol != "" {
+		upgrader.Subprotocols = []string{protocol}
+	}
+	ps.setDebugHeaders(c, pr, apiKey.ID, apiKey.KeyValue, retryCount+1, upstreamURL)
+	responseHeader := http.Header{}
+	for key, values := range c.Writer.Header() {
+		if strings.HasPrefix(key, "X-") {
+			responseHeader[key] = values
+		}
+	}
+	clientConn, err := upgrader.Upgrade(c.Writer, c.Request, responseHeader)
+	if err != nil {
+		// The upgrader has already written the handshake error to the client.
+		ps.logRequest(c, pr, apiKey, http.StatusBadRequest, retryCount+1, err, upstreamURL, nil)
+		return true
+	}
+	defer clientConn.Close()
+
+	ps.keyProvider.RecordKeyOutcome(apiKey, group, true, latency)
+	logrus.Debugf("WebSocket session for group %s opened on attempt %d with key %s", group.Name, retryCount+1, utils.MaskAPIKey(apiKey.KeyValue))
+	session := relayWebSocket(clientConn, upstreamConn, pr)
+	pr.closeCode = session.closeCode
+
+	var sessionErr error
+	switch session.closeCode {
+	case websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived:
+	default:
+		sessionErr = fmt.Errorf("websocket closed with code %d: %s", session.closeCode, session.closeText)
+	}
+	ps.logRequest(c, pr, apiKey, http.StatusSwitchingProtocols, retryCount+1, sessionErr, upstreamURL, session.usage)
+	return true
+}
+
+// handleWebSocketDialError applies the group's retry policy to a failed upstream handshake.
+// It reports whether the handshake should be retried; otherwise the error has been returned to the client.
+func (ps *ProxyServer) handleWebSocketDialError(c *gin.Context, pr *proxyRequest, apiKey *models.APIKey, upstreamURL string, resp *http.Response, dialErr error, retryCount int) (types.RetryError, bool) {
+	group := pr.group
+	cfg := group.EffectiveConfig
+
+	if resp == nil && app_errors.IsIgnorableError(dialErr) {
+		logrus.Debugf("Client-side ignorable error for key %s, aborting retries: %v", utils.MaskAPIKey(apiKey.KeyValue), dialErr)
+		ps.logRequest(c, pr, apiKey, 499, retryCount+1, dialErr, upstreamURL, nil)
+		return types.RetryError{}, false
+	}
+
+	statusCode := http.StatusInternalServerError
+	errorMessage := dialErr.Error()
+	var parsedError string
+	var decision retryDecision
+	if resp == nil {
+		decision = classifyUpstreamError(cfg, 0, errorMessage)
+	} else {
+		// The upstream refused the upgrade with a regular HTTP response.
+		statusCode = resp.StatusCode
+		if errorBody, err := io.ReadAll(resp.Body); err == nil && len(errorBody) > 0 {
+			errorBody = handleGzipCompression(resp, errorBody)
+			errorMessage = string(errorBody)
+			parsedError = app_errors.ParseUpstreamError(errorBody)
+		}
+		resp.Body.Close()
+		decision = classifyUpstreamError(cfg, statusCode, errorMessage)
+	}
+	logrus.Debugf("WebSocket handshake failed with status %d (attempt %d/%d) for key %s: %s", statusCode, retryCount+1, cfg.MaxRetries, utils.MaskAPIKey(apiKey.KeyValue), errorMessage)
+
+	if (resp == nil || statusCode >= http.StatusInternalServerError) && pr.channelHandler.MarkUpstreamFailure(upstreamURL) {
+		decision.PenalizeKey = false
+	}
+	if decision.PenalizeKey {
+		ps.keyProvider.UpdateStatus(apiKey, group, false)
+	}
+
+	retryErr := types.RetryError{
+		StatusCode:         statusCode,
+		ErrorMessage:       errorMessage,
+		ParsedErrorMessage: parsedError,
+		KeyValue:           apiKey.KeyValue,
+		Attempt:            retryCount + 1,
+		UpstreamAddr:       upstreamURL,
+	}
+	if !decision.Retry {
+		ps.respondUpstreamError(c, pr, retryErr, retryCount+1)
+		return retryErr, false
+	}
+	ps.keyProvider.RecordKeyOutcome(apiKey, group, false, 0)
+	ps.keyProvider.ClearKeyAffinity(group, pr.affinityKey)
+	return retryErr, true
+}
+
+// checkWebSocketOrigin allows clients that send no Origin, which are not browsers, same-origin pages,
+// and pages whose origin matches one of the allowed origin patterns.
+func checkWebSocketOrigin(r *http.Request, allowedOrigins string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, pattern := range utils.SplitAndTrim(allowedOrigins, ",") {
+		if utils.MatchGlob(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedSubprotocols returns the subprotocols requested by the client, without the one carrying its proxy key.
+func forwardedSubprotocols(r *http.Request) []string {
+	var protocols []string
+	for _, protocol := range websocket.Subprotocols(r) {
+		if !strings.HasPrefix(protocol, insecureKeyProtocolPrefix) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+// maxCloseReasonSize is the room left for the reason in a close frame: control frames carry at most
+// 125 bytes, two of which hold the close code.
+const maxCloseReasonSize = 123
+
+// truncateCloseReason shortens a close reason to fit in a close frame without splitting a UTF-8 sequence.
+func truncateCloseReason(text string) string {
+	if len(text) <= maxCloseReasonSize {
+		return text
+	}
+	text = text[:maxCloseReasonSize]
+	for len(text) > 0 && !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// webSocketSession is the outcome of a relayed session.
+type webSocketSession struct {
+	closeCode int
+	closeText string
+	usage     *models.TokenUsage
+}
+
+// relayWebSocket pipes messages between the client and the upstream until either side closes,
+// then passes the close code on to the other side. Usage is summed over the Realtime response.done events.
+func relayWebSocket(clientConn, upstreamConn *websocket.Conn, pr *proxyRequest) webSocketSession {
+	var (
+		once    sync.Once
+		wg      sync.WaitGroup
+		session webSocketSession
+		usage   models.TokenUsage
+		done    = make(chan struct{})
+	)
+	finish := func(err error) {
+		once.Do(func() {
+			session.closeCode = websocket.CloseAbnormalClosure
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				session.closeCode = closeErr.Code
+				session.closeText = closeErr.Text
+			} else if err != nil {
+				session.closeText = err.Error()
+			}
+			close(done)
+		})
+	}
+
+	pipe := func(dst, src *websocket.Conn, fromUpstream bool) {
+		defer wg.Done()
+		for {
+			messageType, data, err := src.ReadMessage()
+			if err != nil {
+				finish(err)
+				return
+			}
+			if fromUpstream && messageType == websocket.TextMessage && bytes.Contains(data, []byte(`"response.done"`)) {
+				if u := pr.channelHandler.ExtractUsage(data); u != nil {
+					usage.InputTokens += u.InputTokens
+					usage.OutputTokens += u.OutputTokens
+					usage.CachedTokens += u.CachedTokens
+				}
+			}
+			if err := dst.WriteMessage(messageType, data); err != nil {
+				finish(err)
+				return
+			}
+		}
+	}
+	wg.Add(2)
+	go pipe(upstreamConn, clientConn, false)
+	go pipe(clientConn, upstreamConn, true)
+	<-done
+
+	// Pass the close on to both sides; the side that closed first ignores it.
+	code := session.closeCode
+	if code == websocket.CloseNoStatusReceived || code == websocket.CloseAbnormalClosure {
+		code = websocket.CloseNormalClosure
+	}
+	closeMessage := websocket.FormatCloseMessage(code, truncateCloseReason(session.closeText))
+	deadline := time.Now().Add(time.Second)
+	for _, conn := range []*websocket.Conn{clientConn, upstreamConn} {
+		conn.WriteControl(websocket.CloseMessage, closeMessage, deadline)
+		// Give the other side a moment to answer the close, then stop reading.
+		conn.SetReadDeadline(deadline)
+	}
+	wg.Wait()
+
+	if !usage.IsZero() {
+		session.usage = &usage
+	}
+	return session
+}
@@ -61,6 +61,42 @@ func (gm *GroupManager) Initialize() error {
 				g.HeaderRuleList = []models.HeaderRule{}
 			}
 
+			if len(group.ParamRules) > 0 {
+				if err := json.Unmarshal(group.ParamRules, &g.ParamRuleList); err != nil {
+					logrus.WithError(err).WithField("group_name", g.Name).Warn("Failed to parse param rules for group")
+					g.ParamRuleList = nil
+				}
+			}
+
+			if len(group.Plugins) > 0 {
+				if err := json.Unmarshal(group.Plugins, &g.PluginList); err != nil {
+					logrus.WithError(err).WithField("group_name", g.Name).Warn("Failed to parse plugins for group")
+					g.PluginList = nil
+				}
+			}
+
+			if len(group.ModelFallbacks) > 0 {
+				if err := json.Unmarshal(group.ModelFallbacks, &g.FallbackList); err != nil {
+					logrus.WithError(err).WithField("group_name", g.Name).Warn("Failed to parse model fallbacks for group")
+					g.FallbackList = nil
+				}
+			}
+
+			// Only string targets are usable as model aliases
+			g.ModelMappingMap = make(map[string]string, len(group.ModelMapping))
+			for alias, target := range group.ModelMapping {
+				if model, ok := target.(string); ok && model != "" {
+					g.ModelMappingMap[alias] = model
+				}
+			}
+
+			if g.IsAggregate() && len(group.SubGroups) > 0 {
+				if err := json.Unmarshal(group.SubGroups, &g.SubGroupList); err != nil {
+					logrus.WithError(err).WithField("group_name", g.Name).Warn("Failed to parse sub groups for aggregate group")
+					g.SubGroupList = nil
+				}
+			}
+
 			groupMap[g.Name] = &g
 			logrus.WithFields(logrus.Fields{
 				"group_name":         g.Name,
@@ -100,6 +136,20 @@ func (gm *GroupManager) GetGroupByName(name string) (*models.Group, error) {
 	return group, nil
 }
 
+// GetGroupByID retrieves a single group by its ID from the cache.
+func (gm *GroupManager) GetGroupByID(id uint) (*models.Group, error) {
+	if gm.syncer == nil {
+		return nil, fmt.Errorf("GroupManager is not initialized")
+	}
+
+	for _, group := range gm.syncer.Get() {
+		if group.ID == id {
+			return group, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
 // Invalidate triggers a cache reload across all instances.
 func (gm *GroupManager) Invalidate() error {
 	if gm.syncer == nil {
@@ -38,6 +38,12 @@ type RestoreKeysResult struct {
 	TotalInGroup  int64 `json:"total_in_group"`
 }
 
+// UpdateKeysResult holds the result of updating the settings of multiple keys.
+type UpdateKeysResult struct {
+	UpdatedCount int `json:"updated_count"`
+	IgnoredCount int `json:"ignored_count"`
+}
+
 // KeyService provides services related to API keys.
 type KeyService struct {
 	DB           *gorm.DB
@@ -233,6 +239,46 @@ func (s *KeyService) RestoreMultipleKeys(groupID uint, keysText string) (*Restor
 	}, nil
 }
 
+// UpdateKeyLimits sets the per-key RPM and RPD limits of the keys in a text block.
+func (s *KeyService) UpdateKeyLimits(groupID uint, keysText string, rpmLimit, rpdLimit int) (*UpdateKeysResult, error) {
+	return s.updateKeys(keysText, func(keys []string) (int64, error) {
+		return s.KeyProvider.UpdateKeyLimits(groupID, keys, rpmLimit, rpdLimit)
+	})
+}
+
+// UpdateKeyWeight sets the selection weight of the keys in a text block.
+func (s *KeyService) UpdateKeyWeight(groupID uint, keysText string, weight int) (*UpdateKeysResult, error) {
+	return s.updateKeys(keysText, func(keys []string) (int64, error) {
+		return s.KeyProvider.UpdateKeyWeight(groupID, keys, weight)
+	})
+}
+
+// updateKeys parses a text block and applies an update to the keys in chunks.
+func (s *KeyService) updateKeys(keysText string, update func(keys []string) (int64, error)) (*UpdateKeysResult, error) {
+	keysToUpdate := s.ParseKeysFromText(keysText)
+	if len(keysToUpdate) > maxRequestKeys {
+		return nil, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keysToUpdate))
+	}
+	if len(keysToUpdate) == 0 {
+		return nil, fmt.Errorf("no valid keys found in the input text")
+	}
+
+	var totalUpdatedCount int64
+	for i := 0; i < len(keysToUpdate); i += chunkSize {
+		end := min(i+chunkSize, len(keysToUpdate))
+		updatedCount, err := update(keysToUpdate[i:end])
+		if err != nil {
+			return nil, err
+		}
+		totalUpdatedCount += updatedCount
+	}
+
+	return &UpdateKeysResult{
+		UpdatedCount: int(totalUpdatedCount),
+		IgnoredCount: len(keysToUpdate) - int(totalUpdatedCount),
+	}, nil
+}
+
 // RestoreAllInvalidKeys sets the status of all 'inactive' keys in a group to 'active'.
 func (s *KeyService) RestoreAllInvalidKeys(groupID uint) (int64, error) {
 	return s.KeyProvider.RestoreKeys(groupID)
@@ -61,11 +61,13 @@ func (s *LogCleanupService) run() {
 
 	// 启动时先执行一次清理
 	s.cleanupExpiredLogs()
+	s.cleanupExpiredPayloads()
 
 	for {
 		select {
 		case <-ticker.C:
 			s.cleanupExpiredLogs()
+			s.cleanupExpiredPayloads()
 		case <-s.stopCh:
 			return
 		}
@@ -103,3 +105,26 @@ func (s *LogCleanupService) cleanupExpiredLogs() {
 		logrus.Debug("No expired request logs found to cleanup")
 	}
 }
+
+// cleanupExpiredPayloads 按独立的保留时长清理捕获的请求与响应内容
+func (s *LogCleanupService) cleanupExpiredPayloads() {
+	retentionDays := s.settingsManager.GetSettings().PayloadRetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+
+	cutoffTime := time.Now().AddDate(0, 0, -retentionDays).UTC()
+	result := s.db.Where("timestamp < ?", cutoffTime).Delete(&models.RequestPayload{})
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("Failed to cleanup expired request payloads")
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logrus.WithFields(logrus.Fields{
+			"deleted_count":  result.RowsAffected,
+			"cutoff_time":    cutoffTime.Format(time.RFC3339),
+			"retention_days": retentionDays,
+		}).Info("Successfully cleaned up expired request payloads")
+	}
+}
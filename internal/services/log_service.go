@@ -33,7 +33,7 @@ func NewLogService(db *gorm.DB) *LogService {
 func logFiltersScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if groupName := c.Query("group_name"); groupName != "" {
-			db = db.Where("group_name LIKE ?", "%"+groupName+"%")
+			db = db.Where("group_name LIKE ? OR aggregate_group_name LIKE ?", "%"+groupName+"%", "%"+groupName+"%")
 		}
 		if keyValue := c.Query("key_value"); keyValue != "" {
 			// 安全地处理 keyValue，避免越界错误
@@ -45,6 +45,9 @@ func logFiltersScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
 			}
 			db = db.Where("key_value LIKE ?", likePattern)
 		}
+		if requestID := c.Query("request_id"); requestID != "" {
+			db = db.Where("request_id = ?", requestID)
+		}
 		if model := c.Query("model"); model != "" {
 			db = db.Where("model LIKE ?", "%"+model+"%")
 		}
@@ -104,6 +104,7 @@ func (s *RequestLogService) Stop(ctx context.Context) {
 func (s *RequestLogService) Record(log *models.RequestLog) error {
 	log.ID = uuid.NewString()
 	log.Timestamp = time.Now()
+	log.HasPayload = log.Payload != nil
 
 	if s.settingsManager.GetSettings().RequestLogWriteIntervalMinutes == 0 {
 		return s.writeLogsToDB([]*models.RequestLog{log})
@@ -207,6 +208,20 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 			return fmt.Errorf("failed to batch insert request logs: %w", err)
 		}
 
+		var payloads []*models.RequestPayload
+		for _, log := range logs {
+			if log.Payload != nil {
+				log.Payload.LogID = log.ID
+				log.Payload.Timestamp = log.Timestamp
+				payloads = append(payloads, log.Payload)
+			}
+		}
+		if len(payloads) > 0 {
+			if err := tx.CreateInBatches(payloads, len(payloads)).Error; err != nil {
+				return fmt.Errorf("failed to batch insert request payloads: %w", err)
+			}
+		}
+
 		keyStats := make(map[string]int64)
 		for _, log := range logs {
 			if log.IsSuccess && log.KeyValue != "" {
@@ -237,7 +252,7 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 		hourlyStats := make(map[struct {
 			Time    time.Time
 			GroupID uint
-		}]struct{ Success, Failure int64 })
+		}]struct{ Success, Failure, InputTokens, OutputTokens, CachedTokens int64 })
 		for _, log := range logs {
 			hourlyTime := log.Timestamp.Truncate(time.Hour)
 			key := struct {
@@ -245,13 +260,24 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 				GroupID uint
 			}{Time: hourlyTime, GroupID: log.GroupID}
 
-			counts := hourlyStats[key]
-			if log.IsSuccess {
-				counts.Success++
-			} else {
-				counts.Failure++
+			// Requests served through an aggregate group count towards both the member and the aggregate.
+			groupIDs := []uint{log.GroupID}
+			if log.AggregateGroupID != 0 {
+				groupIDs = append(groupIDs, log.AggregateGroupID)
+			}
+			for _, groupID := range groupIDs {
+				key.GroupID = groupID
+				counts := hourlyStats[key]
+				if log.IsSuccess {
+					counts.Success++
+				} else {
+					counts.Failure++
+				}
+				counts.InputTokens += log.InputTokens
+				counts.OutputTokens += log.OutputTokens
+				counts.CachedTokens += log.CachedTokens
+				hourlyStats[key] = counts
 			}
-			hourlyStats[key] = counts
 		}
 
 		if len(hourlyStats) > 0 {
@@ -261,6 +287,9 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 					DoUpdates: clause.Assignments(map[string]any{
 						"success_count": gorm.Expr("group_hourly_stats.success_count + ?", counts.Success),
 						"failure_count": gorm.Expr("group_hourly_stats.failure_count + ?", counts.Failure),
+						"input_tokens":  gorm.Expr("group_hourly_stats.input_tokens + ?", counts.InputTokens),
+						"output_tokens": gorm.Expr("group_hourly_stats.output_tokens + ?", counts.OutputTokens),
+						"cached_tokens": gorm.Expr("group_hourly_stats.cached_tokens + ?", counts.CachedTokens),
 						"updated_at":    time.Now(),
 					}),
 				}).Create(&models.GroupHourlyStat{
@@ -268,6 +297,9 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 					GroupID:      key.GroupID,
 					SuccessCount: counts.Success,
 					FailureCount: counts.Failure,
+					InputTokens:  counts.InputTokens,
+					OutputTokens: counts.OutputTokens,
+					CachedTokens: counts.CachedTokens,
 				}).Error
 
 				if err != nil {
@@ -17,24 +17,68 @@ type memoryStoreItem struct {
 type MemoryStore struct {
 	mu            sync.RWMutex
 	data          map[string]any
+	expiries      map[string]int64 // Unix-nano expiry of keys of other types than strings, set with Expire.
 	muSubscribers sync.RWMutex
 	subscribers   map[string]map[chan *Message]struct{}
+	stopCh        chan struct{}
+	closeOnce     sync.Once
 }
 
+// memoryStoreCleanupInterval is how often expired keys are removed from memory.
+const memoryStoreCleanupInterval = time.Minute
+
 // NewMemoryStore creates and returns a new MemoryStore instance.
 func NewMemoryStore() *MemoryStore {
 	s := &MemoryStore{
 		data:        make(map[string]any),
+		expiries:    make(map[string]int64),
 		subscribers: make(map[string]map[chan *Message]struct{}),
+		stopCh:      make(chan struct{}),
 	}
+	go s.cleanupLoop()
 	return s
 }
 
 // Close cleans up resources.
 func (s *MemoryStore) Close() error {
+	s.closeOnce.Do(func() { close(s.stopCh) })
 	return nil
 }
 
+// cleanupLoop periodically removes expired keys, which would otherwise only be evicted when they are read again.
+func (s *MemoryStore) cleanupLoop() {
+	ticker := time.NewTicker(memoryStoreCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpired()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// deleteExpired removes all expired keys.
+func (s *MemoryStore) deleteExpired() {
+	now := time.Now().UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, rawItem := range s.data {
+		if item, ok := rawItem.(memoryStoreItem); ok && item.expiresAt > 0 && now > item.expiresAt {
+			delete(s.data, key)
+		}
+	}
+	for key, expiresAt := range s.expiries {
+		if now > expiresAt {
+			delete(s.data, key)
+			delete(s.expiries, key)
+		}
+	}
+}
+
 // Set stores a key-value pair.
 func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
 	s.mu.Lock()
@@ -49,6 +93,7 @@ func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
 		value:     value,
 		expiresAt: expiresAt,
 	}
+	delete(s.expiries, key)
 	return nil
 }
 
@@ -82,6 +127,7 @@ func (s *MemoryStore) Delete(key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.data, key)
+	delete(s.expiries, key)
 	return nil
 }
 
@@ -91,6 +137,7 @@ func (s *MemoryStore) Del(keys ...string) error {
 	defer s.mu.Unlock()
 	for _, key := range keys {
 		delete(s.data, key)
+		delete(s.expiries, key)
 	}
 	return nil
 }
@@ -146,6 +193,25 @@ func (s *MemoryStore) SetNX(key string, value []byte, ttl time.Duration) (bool,
 	return true, nil
 }
 
+// Expire sets a TTL on an existing key. Hashes, lists and sets are removed by the cleanup loop once expired.
+func (s *MemoryStore) Expire(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rawItem, exists := s.data[key]
+	if !exists {
+		return nil
+	}
+	expiresAt := time.Now().UnixNano() + ttl.Nanoseconds()
+	if item, ok := rawItem.(memoryStoreItem); ok {
+		item.expiresAt = expiresAt
+		s.data[key] = item
+		return nil
+	}
+	s.expiries[key] = expiresAt
+	return nil
+}
+
 // --- HASH operations ---
 
 func (s *MemoryStore) HSet(key string, values map[string]any) error {
@@ -217,6 +283,34 @@ func (s *MemoryStore) HIncrBy(key, field string, incr int64) (int64, error) {
 	return newVal, nil
 }
 
+func (s *MemoryStore) HDel(key string, fields ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rawHash, exists := s.data[key]
+	if !exists {
+		return 0, nil
+	}
+
+	hash, ok := rawHash.(map[string]string)
+	if !ok {
+		return 0, fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
+	}
+
+	var deleted int64
+	for _, field := range fields {
+		if _, ok := hash[field]; ok {
+			delete(hash, field)
+			deleted++
+		}
+	}
+	if len(hash) == 0 {
+		delete(s.data, key)
+		delete(s.expiries, key)
+	}
+	return deleted, nil
+}
+
 // --- LIST operations ---
 
 func (s *MemoryStore) LPush(key string, values ...any) error {
@@ -302,6 +396,38 @@ func (s *MemoryStore) Rotate(key string) (string, error) {
 	return item, nil
 }
 
+// LRange returns the elements between start and stop (inclusive), supporting negative indexes like Redis.
+func (s *MemoryStore) LRange(key string, start, stop int64) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rawList, exists := s.data[key]
+	if !exists {
+		return []string{}, nil
+	}
+
+	list, ok := rawList.([]string)
+	if !ok {
+		return nil, fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
+	}
+
+	length := int64(len(list))
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	stop = min(stop, length-1)
+	if start > stop {
+		return []string{}, nil
+	}
+
+	result := make([]string, stop-start+1)
+	copy(result, list[start:stop+1])
+	return result, nil
+}
+
 // --- SET operations ---
 
 // SAdd adds members to a set.
@@ -64,6 +64,11 @@ func (s *RedisStore) SetNX(key string, value []byte, ttl time.Duration) (bool, e
 	return s.client.SetNX(context.Background(), key, value, ttl).Result()
 }
 
+// Expire sets a TTL on an existing key in Redis.
+func (s *RedisStore) Expire(key string, ttl time.Duration) error {
+	return s.client.Expire(context.Background(), key, ttl).Err()
+}
+
 // Close closes the Redis client connection.
 func (s *RedisStore) Close() error {
 	return s.client.Close()
@@ -83,6 +88,10 @@ func (s *RedisStore) HIncrBy(key, field string, incr int64) (int64, error) {
 	return s.client.HIncrBy(context.Background(), key, field, incr).Result()
 }
 
+func (s *RedisStore) HDel(key string, fields ...string) (int64, error) {
+	return s.client.HDel(context.Background(), key, fields...).Result()
+}
+
 // --- LIST operations ---
 
 func (s *RedisStore) LPush(key string, values ...any) error {
@@ -104,6 +113,10 @@ func (s *RedisStore) Rotate(key string) (string, error) {
 	return val, nil
 }
 
+func (s *RedisStore) LRange(key string, start, stop int64) ([]string, error) {
+	return s.client.LRange(context.Background(), key, start, stop).Result()
+}
+
 // --- SET operations ---
 
 func (s *RedisStore) SAdd(key string, members ...any) error {
@@ -40,15 +40,20 @@ type Store interface {
 	// SetNX sets a key-value pair if the key does not already exist.
 	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
 
+	// Expire sets a TTL on an existing key of any type, such as a HASH.
+	Expire(key string, ttl time.Duration) error
+
 	// HASH operations
 	HSet(key string, values map[string]any) error
 	HGetAll(key string) (map[string]string, error)
 	HIncrBy(key, field string, incr int64) (int64, error)
+	HDel(key string, fields ...string) (int64, error)
 
 	// LIST operations
 	LPush(key string, values ...any) error
 	LRem(key string, count int64, value any) error
 	Rotate(key string) (string, error)
+	LRange(key string, start, stop int64) ([]string, error)
 
 	// SET operations
 	SAdd(key string, members ...any) error
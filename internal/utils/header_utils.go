@@ -12,9 +12,11 @@ import (
 
 // HeaderVariableContext holds context data for variable resolution
 type HeaderVariableContext struct {
-	ClientIP string
-	Group    *models.Group
-	APIKey   *models.APIKey
+	ClientIP  string
+	RequestID string
+	Model     string
+	Group     *models.Group
+	APIKey    *models.APIKey
 }
 
 // ResolveHeaderVariables resolves dynamic variables in header values
@@ -33,6 +35,9 @@ func ResolveHeaderVariables(value string, ctx *HeaderVariableContext) string {
 		"${TIMESTAMP_S}":  strconv.FormatInt(now.Unix(), 10),
 	}
 
+	variables["${REQUEST_ID}"] = ctx.RequestID
+	variables["${MODEL}"] = ctx.Model
+
 	if ctx.Group != nil {
 		variables["${GROUP_NAME}"] = ctx.Group.Name
 	}
@@ -75,9 +80,10 @@ func NewHeaderVariableContextFromGin(c *gin.Context, group *models.Group, apiKey
 	}
 
 	return &HeaderVariableContext{
-		ClientIP: c.ClientIP(),
-		Group:    group,
-		APIKey:   apiKey,
+		ClientIP:  c.ClientIP(),
+		RequestID: c.GetString("requestID"),
+		Group:     group,
+		APIKey:    apiKey,
 	}
 }
 
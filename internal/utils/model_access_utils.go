@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ModelAccessRule restricts the models a client may request.
+// Patterns are case-insensitive globs where * matches any characters and ? matches a single character.
+type ModelAccessRule struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Permits reports whether the model is allowed: it must not match a deny pattern and, when allow patterns are set,
+// must match one of them.
+func (r ModelAccessRule) Permits(model string) bool {
+	for _, pattern := range r.Deny {
+		if MatchGlob(pattern, model) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range r.Allow {
+		if MatchGlob(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseProxyKeyModelRules parses a JSON object mapping proxy keys to their model access rules,
+// e.g. {"sk-cheap": {"allow": ["gpt-4o-mini*"], "deny": ["*opus*"]}}.
+func ParseProxyKeyModelRules(s string) (map[string]ModelAccessRule, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var rules map[string]ModelAccessRule
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return nil, fmt.Errorf("model rules must be a JSON object mapping proxy keys to {\"allow\": [...], \"deny\": [...]}: %w", err)
+	}
+	return rules, nil
+}
+
+// MatchGlob reports whether s matches the pattern, ignoring case. Unlike path.Match, * also matches "/".
+func MatchGlob(pattern, s string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	s = strings.ToLower(s)
+
+	// Iterative wildcard matching with backtracking to the last *.
+	p, i := 0, 0
+	star, match := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, i
+			p++
+		case star >= 0:
+			p = star + 1
+			match++
+			i = match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
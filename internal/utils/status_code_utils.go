@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusCodeRange is an inclusive range of HTTP status codes.
+type StatusCodeRange struct {
+	Min int
+	Max int
+}
+
+// ParseStatusCodeRanges parses a comma-separated list of status codes and ranges, e.g. "401,429,500-599".
+func ParseStatusCodeRanges(s string) ([]StatusCodeRange, error) {
+	var ranges []StatusCodeRange
+	for _, part := range SplitAndTrim(s, ",") {
+		minStr, maxStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			maxStr = minStr
+		}
+
+		minCode, err := parseStatusCode(minStr)
+		if err != nil {
+			return nil, err
+		}
+		maxCode, err := parseStatusCode(maxStr)
+		if err != nil {
+			return nil, err
+		}
+		if minCode > maxCode {
+			return nil, fmt.Errorf("invalid status code range '%s'", part)
+		}
+		ranges = append(ranges, StatusCodeRange{Min: minCode, Max: maxCode})
+	}
+	return ranges, nil
+}
+
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("invalid status code '%s'", s)
+	}
+	return code, nil
+}
+
+// MatchStatusCode reports whether the status code falls into any of the ranges.
+func MatchStatusCode(ranges []StatusCodeRange, code int) bool {
+	for _, r := range ranges {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}